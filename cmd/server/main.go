@@ -1,17 +1,66 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
 	"github.com/jordanOBL/TrailTasksWebSockets/internal/server"
 )
 
 func main() {
 	//create new server
 	s := server.NewServer("", 8080)
+
+	//load the server wide deny list, admin endpoints stay off without a token
+	denyList, err := server.LoadDenyList("denylist.json")
+	if err != nil {
+		panic(err)
+	}
+	s.DenyList = denyList
+	s.AdminToken = os.Getenv("TRAILTASKS_ADMIN_TOKEN")
+
+	//cap every room's size, rooms pick their own limit below it
+	if maxRoomSize := os.Getenv("TRAILTASKS_MAX_ROOM_SIZE"); maxRoomSize != "" {
+		s.MaxRoomSize, err = strconv.Atoi(maxRoomSize)
+		if err != nil || s.MaxRoomSize < 0 {
+			panic("TRAILTASKS_MAX_ROOM_SIZE must be a non-negative number")
+		}
+	}
+
+	//record privileged room actions to an append only audit log
+	auditSink, err := server.NewFileAuditSink("audit.log")
+	if err != nil {
+		panic(err)
+	}
+	defer auditSink.Close()
+	s.AuditSink = auditSink
+
+	//persistent rooms survive restarts in rooms.json
+	roomStore, err := server.LoadRoomStore("rooms.json")
+	if err != nil {
+		panic(err)
+	}
+	s.RoomStore = roomStore
+
+	//built in timer presets plus any from presets.json
+	presets, err := server.LoadPresets("presets.json")
+	if err != nil {
+		panic(err)
+	}
+	s.AddPresets(presets)
+
 	//start server
-	err := s.Start()
+	err = s.Start()
 	if err != nil {
 		panic(err)
 	}
-	select {}
 
+	//run until interrupted, then stop so the deferred closes get to run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	s.Stop()
 }
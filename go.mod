@@ -6,4 +6,6 @@ replace github.com/jordanOBL/TrailTasksWebSockets => .
 
 require github.com/gorilla/websocket v1.5.0
 
-require github.com/google/uuid v1.6.0 // indirect
+require github.com/google/uuid v1.6.0
+
+require golang.org/x/text v0.21.0
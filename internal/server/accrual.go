@@ -0,0 +1,73 @@
+package server
+
+import "math"
+
+// levelDistanceFactor is the distance, in miles, per session level.
+const levelDistanceFactor = 0.5
+
+// accrue adds the distance each unpaused, still focused hiker covered since
+// the last accrual: the focus time in between at the effective pace. Hikers in
+// overtime cover their break time at the overtime rate. Ticks only decide how
+// often it runs, so late or missed ticks don't change the totals.
+func (r *Room) accrue() {
+	r.accrueMux.Lock()
+	defer r.accrueMux.Unlock()
+	r.accrueLocked()
+}
+
+// accrueLocked is accrue for callers that hold accrueMux, e.g. to settle the
+// distance before a hiker pauses or resumes.
+func (r *Room) accrueLocked() {
+	miles, overtime := r.Timer.takeMiles()
+	if miles <= 0 && overtime <= 0 {
+		return
+	}
+	r.HikersMux.Lock()
+	defer r.HikersMux.Unlock()
+	for _, hiker := range r.Hikers {
+		if hiker.IsPaused {
+			continue
+		}
+		if miles > 0 && !hiker.FocusStopped {
+			hiker.Distance += miles
+			r.Session.Distance += miles
+		}
+		if overtime > 0 && hiker.Overtime {
+			hiker.OvertimeDistance += overtime
+			r.Session.OvertimeDistance += overtime
+		}
+	}
+	r.Session.Level = uint8(math.Floor(r.Session.Distance/levelDistanceFactor) + 1)
+	if r.Session.Level > r.Session.HighestCompletedLevel {
+		r.Session.HighestCompletedLevel = r.Session.Level
+	}
+}
+
+// takeMiles returns the miles covered since the last call, at the effective
+// pace during focus or at overtimeRate times Pace during a break, and moves
+// accruedAt up. Only running time counts, up to the end of the phase.
+func (t *Timer) takeMiles() (miles float64, overtime float64) {
+	t.TimerMux.Lock()
+	defer t.TimerMux.Unlock()
+	phase := t.currentPhase()
+	if phase != PhaseFocus && !phase.isBreak() {
+		return 0, 0
+	}
+	until := t.clock().Now()
+	if t.IsPaused {
+		until = t.PausedAt
+	}
+	if end := t.StartTimestamp.Add(t.Duration); t.Duration > 0 && until.After(end) {
+		until = end
+	}
+	if !until.After(t.accruedAt) {
+		return 0, 0
+	}
+	hours := until.Sub(t.accruedAt).Hours()
+	t.accruedAt = until
+	if phase.isBreak() {
+		// A break interval's pace is for the room, overtime goes on at the focus pace
+		return 0, hours * float64(t.Pace) * t.overtimeRate()
+	}
+	return hours * float64(t.effectivePace()), 0
+}
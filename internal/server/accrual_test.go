@@ -0,0 +1,88 @@
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDistanceAccruesByElapsedTime(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, hiker)
+	room.Timer.FocusTime = 3600
+	room.Timer.UpdateEvery = 7 // Ticks that don't line up with the phase
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(15 * time.Minute)
+	if err := room.pauseHiker_protocol(hiker); err != nil {
+		t.Fatalf("pause failed: %v", err)
+	}
+	strikeDistance := hiker.Distance
+	clock.Advance(15 * time.Minute)
+	if err := room.resumeHiker_protocol(hiker); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	// A faster pace counts from when it was set
+	err := room.updateConfig_protocol(host, "", map[string]interface{}{"pace": 4}, nil, nil)
+	if err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := room.resumeRoom_protocol(host); err != nil {
+		t.Fatalf("resumeRoom failed: %v", err)
+	}
+	// Past the end of focus and into the break
+	clock.Advance(21 * time.Minute)
+	if room.Timer.Phase != PhaseShortBreak {
+		t.Fatalf("expected a short break, got %s", room.Timer.Phase)
+	}
+	room.update_protocol()
+
+	// 30 minutes at 2 mph, then 30 at 4 mph around the room pause
+	want := 1.0 + 30.0/60*4
+	if math.Abs(host.Distance-want) > 1e-9 {
+		t.Fatalf("expected the host to cover %f miles, got %f", want, host.Distance)
+	}
+	// The hiker sat out the 15 minutes after the first 15, 0.5 miles each
+	if got := hiker.Distance - strikeDistance; math.Abs(got-(want-1.0)) > 1e-9 {
+		t.Fatalf("expected the hiker to cover %f miles after the pause, got %f", want-1.0, got)
+	}
+}
+
+func TestMembershipChangesSettleDistance(t *testing.T) {
+	host := newTestHiker("1")
+	leaver := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, leaver)
+	room.Timer.UpdateEvery = 600 // No tick before the checks
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(6 * time.Minute)
+	if err := room.leave_protocol(leaver); err != nil {
+		t.Fatalf("leave failed: %v", err)
+	}
+	clock.Advance(3 * time.Minute)
+	newcomer := newTestHiker("3")
+	if err := room.join_protocol(newcomer); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	clock.Advance(3 * time.Minute)
+	room.update_protocol()
+
+	// 12, 6 and 3 minutes at 2 mph
+	if math.Abs(host.Distance-0.4) > 1e-9 || math.Abs(leaver.Distance-0.2) > 1e-9 || math.Abs(newcomer.Distance-0.1) > 1e-9 {
+		t.Fatalf("expected 0.4, 0.2 and 0.1 miles, got %f, %f and %f", host.Distance, leaver.Distance, newcomer.Distance)
+	}
+	if math.Abs(room.Session.Distance-0.7) > 1e-9 {
+		t.Fatalf("expected the session to cover 0.7 miles, got %f", room.Session.Distance)
+	}
+}
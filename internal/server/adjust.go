@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultMaxTimeAdjustment is how much adjustTime can change a phase when the
+// room doesn't set maxTimeAdjustment.
+const DefaultMaxTimeAdjustment = 30 * time.Minute
+
+const maxTimeAdjustment = 4 * 60 * 60 // Seconds, the most a room can set maxTimeAdjustment to
+
+// minTimeLeft is the least a phase can be shortened to, skipBreak and end
+// stop a phase outright.
+const minTimeLeft = 10 * time.Second
+
+// AdjustTime lengthens the current phase by d, or shortens it when d is
+// negative, and returns the time it has left. The phase's total adjustment
+// can't exceed limit either way. A paused phase keeps its new length for when
+// it resumes.
+func (t *Timer) AdjustTime(r *Room, d time.Duration, limit time.Duration) (time.Duration, error) {
+	t.TimerMux.Lock()
+	defer t.TimerMux.Unlock()
+	if !t.IsRunning || t.phaseEnd == nil {
+		return 0, fmt.Errorf("no phase is counting down")
+	}
+	adjusted := t.Adjusted + d
+	if adjusted > limit || adjusted < -limit {
+		return 0, fmt.Errorf("a phase can only be adjusted by up to %s", limit)
+	}
+	now := t.clock().Now()
+	if t.IsPaused {
+		now = t.PausedAt
+	}
+	remaining := t.Duration - now.Sub(t.StartTimestamp) + d
+	if remaining < minTimeLeft {
+		return 0, fmt.Errorf("at least %s must be left", minTimeLeft)
+	}
+
+	if !t.IsPaused {
+		if t.CountdownTimer != nil && !t.CountdownTimer.Stop() {
+			// The phase ended as we adjusted, its callback is already running
+			return 0, fmt.Errorf("the phase is changing, try again")
+		}
+		t.startCountdown(r, remaining, t.phaseEnd)
+	}
+	t.Duration += d
+	t.Adjusted = adjusted
+	return remaining, nil
+}
+
+// maxTimeAdjustment is the room's limit on adjustTime.
+func (r *Room) maxTimeAdjustment() time.Duration {
+	r.ConfigMux.RLock()
+	defer r.ConfigMux.RUnlock()
+	if r.Config.MaxTimeAdjustment > 0 {
+		return time.Duration(r.Config.MaxTimeAdjustment) * time.Second
+	}
+	return DefaultMaxTimeAdjustment
+}
+
+// adjustTime_protocol lets the host or a co-host add seconds to the current
+// phase, or take them off when seconds is negative.
+func (r *Room) adjustTime_protocol(h *Client, seconds int) error {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host or a co-host can adjust the time")
+		return fmt.Errorf("error in adjustTime_protocol: %s is not the host or a co-host", h.Id)
+	}
+	if seconds == 0 {
+		r.sendError(h, "Cannot adjust the time by 0 seconds")
+		return fmt.Errorf("error in adjustTime_protocol: no seconds given")
+	}
+	limit := r.maxTimeAdjustment()
+	if seconds > int(limit.Seconds()) || seconds < -int(limit.Seconds()) {
+		// Checked before converting, a huge number would overflow the Duration
+		r.sendError(h, fmt.Sprintf("Cannot adjust the time: a phase can only be adjusted by up to %s", limit))
+		return fmt.Errorf("error in adjustTime_protocol: %d seconds is over the limit", seconds)
+	}
+	d := time.Duration(seconds) * time.Second
+	remainingTime, err := r.Timer.AdjustTime(r, d, limit)
+	if err != nil {
+		r.sendError(h, "Cannot adjust the time: "+err.Error())
+		return fmt.Errorf("error in adjustTime_protocol: %v", err)
+	}
+
+	message := fmt.Sprintf("%s added %s", h.Username, d)
+	if d < 0 {
+		message = fmt.Sprintf("%s took %s off", h.Username, -d)
+	}
+	r.audit(h, "adjustTime", map[string]interface{}{
+		"seconds":       seconds,
+		"remainingTime": remainingTime.Seconds(),
+	})
+	err = r.broadcast("timeAdjusted", map[string]interface{}{
+		"type":          "broadcast",
+		"seconds":       seconds,
+		"by":            h.Username,
+		"byId":          h.Id,
+		"timer":         r.Timer,
+		"remainingTime": remainingTime.Seconds(),
+		"message":       message,
+	})
+	r.publishLobby()
+	return err
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAdjustTimeMovesTheDeadline(t *testing.T) {
+	host := newTestHiker("1")
+	guest := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, guest)
+	room.Config.MaxTimeAdjustment = 600
+
+	if err := room.adjustTime_protocol(host, 300); err == nil {
+		t.Fatal("expected adjusting an idle timer to fail")
+	}
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if err := room.adjustTime_protocol(guest, 300); err == nil {
+		t.Fatal("expected a guest to be refused")
+	}
+
+	clock.Advance(1000 * time.Second)
+	if err := room.adjustTime_protocol(host, 300); err != nil {
+		t.Fatalf("adjustTime failed: %v", err)
+	}
+	packet := waitForProtocol(t, host, "timeAdjusted")
+	if packet.Response["remainingTime"] != 800.0 || packet.Response["byId"] != host.Id {
+		t.Fatalf("expected 800s left set by the host, got %+v", packet.Response)
+	}
+	if err := room.adjustTime_protocol(host, 400); err == nil {
+		t.Fatal("expected adjustments past maxTimeAdjustment to fail")
+	}
+	for _, seconds := range []int{math.MaxInt, math.MinInt} {
+		if err := room.adjustTime_protocol(host, seconds); err == nil {
+			t.Fatalf("expected %d seconds to be refused", seconds)
+		}
+	}
+	if room.Timer.Adjusted != 300*time.Second {
+		t.Fatalf("a refused adjustment changed the phase by %s", room.Timer.Adjusted)
+	}
+	if err := room.adjustTime_protocol(host, -795); err == nil {
+		t.Fatal("expected shortening below the minimum to fail")
+	}
+
+	// The original deadline passes without ending focus
+	clock.Advance(500 * time.Second)
+	if room.Timer.Phase != PhaseFocus || room.Timer.RemainingTime() != 300*time.Second {
+		t.Fatalf("expected 300s of focus left, got %s with %s", room.Timer.Phase, room.Timer.RemainingTime())
+	}
+	clock.Advance(300 * time.Second)
+	if room.Timer.Phase != PhaseShortBreak || room.Timer.Adjusted != 0 {
+		t.Fatalf("expected an unadjusted short break, got %s adjusted by %s", room.Timer.Phase, room.Timer.Adjusted)
+	}
+
+	// Shortening a paused break holds until it resumes
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	if err := room.adjustTime_protocol(host, -240); err != nil {
+		t.Fatalf("adjustTime failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := room.resumeRoom_protocol(host); err != nil {
+		t.Fatalf("resumeRoom failed: %v", err)
+	}
+	clock.Advance(60 * time.Second)
+	if room.Timer.Phase != PhaseFocus {
+		t.Fatalf("expected focus after the shortened break, got %s", room.Timer.Phase)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry records one privileged action taken in a room.
+type AuditEntry struct {
+	Timestamp time.Time              `json:"timestamp"`
+	RoomId    string                 `json:"roomId"`
+	ActorId   string                 `json:"actorId"` // "server" for automatic actions
+	ActorName string                 `json:"actorName,omitempty"`
+	Action    string                 `json:"action"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+}
+
+// AuditSink stores audit entries.
+type AuditSink interface {
+	Record(entry AuditEntry) error
+}
+
+// FileAuditSink appends audit entries to a local file as JSON lines.
+type FileAuditSink struct {
+	mux  sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink opens path for appending, creating it if needed.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("NewFileAuditSink error: %v", err)
+	}
+	return &FileAuditSink{file: file}, nil
+}
+
+func (f *FileAuditSink) Record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("FileAuditSink record error: %v", err)
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("FileAuditSink record error: %v", err)
+	}
+	return nil
+}
+
+func (f *FileAuditSink) Close() error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.file.Close()
+}
+
+// audit records action by actor to the room's sink. A nil actor marks an
+// automatic action taken by the server.
+func (r *Room) audit(actor *Client, action string, payload map[string]interface{}) {
+	if r.Audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Timestamp: r.clock().Now().UTC(),
+		RoomId:    r.Id,
+		ActorId:   "server",
+		Action:    action,
+		Payload:   payload,
+	}
+	if actor != nil {
+		entry.ActorId = actor.Id
+		entry.ActorName = actor.Username
+	}
+	if err := r.Audit.Record(entry); err != nil {
+		fmt.Printf("Error recording audit entry for room %s: %v\n", r.Id, err)
+	}
+}
+
+// configSnapshot captures the current timer, session and room config as plain
+// values for the audit trail. The caller must hold the timer and session locks.
+func (r *Room) configSnapshot() map[string]interface{} {
+	r.ConfigMux.RLock()
+	roomConfig := r.Config
+	r.ConfigMux.RUnlock()
+
+	snapshot := map[string]interface{}{}
+	for key, value := range map[string]interface{}{"timer": r.Timer, "session": r.Session, "room": roomConfig} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		var decoded map[string]interface{}
+		if json.Unmarshal(data, &decoded) == nil {
+			snapshot[key] = decoded
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditTrailWrittenToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewFileAuditSink failed: %v", err)
+	}
+	defer sink.Close()
+
+	host := newTestHiker("1")
+	other := newTestHiker("2")
+	room := newTestRoom(host, other)
+	room.Audit = sink
+
+	err = room.updateConfig_protocol(host, "", map[string]interface{}{"focusTime": 600}, map[string]interface{}{}, nil)
+	if err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if err := room.kick_protocol(host, other.Id); err != nil {
+		t.Fatalf("kick failed: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log failed: %v", err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("bad audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(entries))
+	}
+	config := entries[0]
+	if config.Action != "updateConfig" || config.ActorId != host.Id || config.RoomId != room.Id {
+		t.Fatalf("unexpected config entry: %+v", config)
+	}
+	before := config.Payload["before"].(map[string]interface{})["timer"].(map[string]interface{})
+	after := config.Payload["after"].(map[string]interface{})["timer"].(map[string]interface{})
+	if before["focusTime"] != float64(1500) || after["focusTime"] != float64(600) {
+		t.Fatalf("expected focusTime 1500 -> 600, got %v -> %v", before["focusTime"], after["focusTime"])
+	}
+	if entries[1].Action != "kick" || entries[1].Payload["userId"] != other.Id {
+		t.Fatalf("unexpected kick entry: %+v", entries[1])
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"sort"
+	"time"
+)
+
+// Ban records a hiker that the host removed from the room and is not
+// allowed back in.
+type Ban struct {
+	UserId   string    `json:"userId"`
+	Username string    `json:"username"`
+	Ip       string    `json:"ip,omitempty"` // Only set when the host asked for an IP ban
+	Reason   string    `json:"reason"`
+	BannedBy string    `json:"bannedBy"`
+	BannedAt time.Time `json:"bannedAt"`
+}
+
+// isBanned reports whether h matches a ban by user id or by IP.
+func (r *Room) isBanned(h *Client) bool {
+	r.BansMux.RLock()
+	defer r.BansMux.RUnlock()
+	for _, ban := range r.Bans {
+		if ban.UserId == h.Id {
+			return true
+		}
+		if ban.Ip != "" && ban.Ip == h.Ip {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Room) addBan(ban *Ban) {
+	r.BansMux.Lock()
+	defer r.BansMux.Unlock()
+	if r.Bans == nil {
+		r.Bans = make(map[string]*Ban)
+	}
+	r.Bans[ban.UserId] = ban
+}
+
+// removeBan lifts the ban for userId and reports whether one existed.
+func (r *Room) removeBan(userId string) bool {
+	r.BansMux.Lock()
+	defer r.BansMux.Unlock()
+	_, ok := r.Bans[userId]
+	delete(r.Bans, userId)
+	return ok
+}
+
+// banList returns the room's bans, oldest first.
+func (r *Room) banList() []*Ban {
+	r.BansMux.RLock()
+	defer r.BansMux.RUnlock()
+	bans := make([]*Ban, 0, len(r.Bans))
+	for _, ban := range r.Bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].BannedAt.Before(bans[j].BannedAt)
+	})
+	return bans
+}
@@ -3,25 +3,34 @@ package server
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	ws "github.com/gorilla/websocket"
 )
 
 type Client struct {
-	mux             sync.RWMutex      `json:"-"`
-	Conn            *ws.Conn          `json:"-"`
-	Id              string            `json:"id"`
-	IsHost          bool              `json:"isHost"`
-	Username        string            `json:"username"`
-	Distance        float64           `json:"distance"`
-	IsReady         bool              `json:"isReady"`
-	IsPaused        bool              `json:"isPaused"`
-	Strikes         uint8             `json:"strikes"`
-	MsgCh           chan ServerPacket `json:"-"`
-	droppedMessages uint8             `json:"-"`
-	TokensEarned    uint8             `json:"tokensEarned"`
-	BonusTokens     uint8             `json:"bonusTokens"`
-	RoomId          string            `json:"roomId"`
+	mux              sync.RWMutex      `json:"-"`
+	Conn             *ws.Conn          `json:"-"`
+	Id               string            `json:"id"`
+	IsHost           bool              `json:"isHost"`
+	IsCoHost         bool              `json:"isCoHost"`
+	IsSpectator      bool              `json:"isSpectator"`
+	Username         string            `json:"username"`
+	Distance         float64           `json:"distance"`
+	IsReady          bool              `json:"isReady"`
+	IsPaused         bool              `json:"isPaused"`
+	FocusStopped     bool              `json:"focusStopped"` // Sent stopFocus during flowtime focus
+	Overtime         bool              `json:"overtime"`     // Hikes on through the break, see overtime_protocol
+	OvertimeDistance float64           `json:"overtimeDistance"`
+	Strikes          uint8             `json:"strikes"`
+	MsgCh            chan ServerPacket `json:"-"`
+	droppedMessages  uint8             `json:"-"`
+	TokensEarned     uint8             `json:"tokensEarned"`
+	BonusTokens      uint8             `json:"bonusTokens"`
+	RoomId           string            `json:"roomId"`
+	Ip               string            `json:"-"`
+	JoinedAt         time.Time         `json:"joinedAt"`
+	Clock            Clock             `json:"-"` // Stamps timeSync replies, wall clock when nil
 }
 
 type ClientPacket struct {
@@ -39,10 +48,83 @@ func (c *Client) writePump() {
 				fmt.Printf("Message channel closed for %v\n", c.Username)
 				return
 			}
+			if msg.stampTransmit {
+				msg.Response["serverTransmitTime"] = c.clock().Now().UnixMilli()
+			}
 			if err := c.Conn.WriteJSON(msg); err != nil {
 				fmt.Printf("Error in writePump for %v: %v\n", c.Username, err)
 				return
 			}
+			if msg.closeConn {
+				c.Conn.WriteMessage(ws.CloseMessage, ws.FormatCloseMessage(ws.ClosePolicyViolation, msg.Header.Protocol))
+				c.Conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// roomId returns the id of the room c is in, or waiting for, "" when none.
+// RoomId is guarded by mux, the room and the client's read loop both use it.
+func (c *Client) roomId() string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.RoomId
+}
+
+func (c *Client) setRoomId(id string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.RoomId = id
+}
+
+// takeRoomId clears and returns c's room id, so only one caller removes c
+// from its room.
+func (c *Client) takeRoomId() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	id := c.RoomId
+	c.RoomId = ""
+	return id
+}
+
+func (c *Client) clock() Clock {
+	if c.Clock == nil {
+		return RealClock{}
+	}
+	return c.Clock
+}
+
+// disconnect queues a final packet for the client and closes its connection
+// once the packet has been written. If the channel is full the connection is
+// closed right away.
+func (c *Client) disconnect(packet ServerPacket) {
+	packet.closeConn = true
+	select {
+	case c.MsgCh <- packet:
+	default:
+		if c.Conn != nil {
+			c.Conn.Close()
 		}
 	}
 }
+
+// stringField returns the string value stored under key in the packet message,
+// or "" if it is missing or not a string.
+func (p *ClientPacket) stringField(key string) string {
+	value, _ := p.Message[key].(string)
+	return value
+}
+
+// intField returns the number stored under key in the packet message as an
+// int, or 0 if it is missing or not a number.
+func (p *ClientPacket) intField(key string) int {
+	value, _ := p.Message[key].(float64)
+	return int(value)
+}
+
+// boolField returns the bool value stored under key in the packet message.
+func (p *ClientPacket) boolField(key string) bool {
+	value, _ := p.Message[key].(bool)
+	return value
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for timers, schedules and broadcast timeouts,
+// so tests can replace the wall clock with a FakeClock.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) ClockTimer
+	NewTicker(d time.Duration) ClockTicker
+	After(d time.Duration) <-chan time.Time
+}
+
+// ClockTimer is a pending AfterFunc call.
+type ClockTimer interface {
+	Stop() bool
+}
+
+// ClockTicker delivers ticks on C until stopped.
+type ClockTicker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the wall clock.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time { return time.Now() }
+
+func (RealClock) AfterFunc(d time.Duration, f func()) ClockTimer { return time.AfterFunc(d, f) }
+
+func (RealClock) NewTicker(d time.Duration) ClockTicker { return realTicker{time.NewTicker(d)} }
+
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// FakeClock only moves when Advance is called. AfterFunc callbacks run on the
+// goroutine calling Advance, in time order.
+type FakeClock struct {
+	mux     sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+type fakeWaiter struct {
+	clock  *FakeClock
+	at     time.Time
+	period time.Duration // Repeats when non zero
+	f      func()
+	ch     chan time.Time
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return c.add(&fakeWaiter{clock: c, at: c.Now().Add(d), f: f})
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) ClockTicker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return fakeTicker{c.add(&fakeWaiter{clock: c, at: c.Now().Add(d), period: d, ch: make(chan time.Time, 1)})}
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.add(&fakeWaiter{clock: c, at: c.Now().Add(d), ch: make(chan time.Time, 1)}).ch
+}
+
+func (c *FakeClock) add(w *fakeWaiter) *fakeWaiter {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+// remove drops w and reports whether it was pending. The caller must hold mux.
+func (c *FakeClock) remove(w *fakeWaiter) bool {
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock forward by d, firing every timer and tick due on
+// the way. Timers set by the callbacks fire too if they fall within d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	target := c.now.Add(d)
+	c.mux.Unlock()
+	for c.fireNext(target) {
+	}
+}
+
+// fireNext fires the earliest waiter due by target and reports whether there
+// was one. Once nothing is due the clock is set to target.
+func (c *FakeClock) fireNext(target time.Time) bool {
+	c.mux.Lock()
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	if len(c.waiters) == 0 || c.waiters[0].at.After(target) {
+		c.now = target
+		c.mux.Unlock()
+		return false
+	}
+	w := c.waiters[0]
+	c.now = w.at
+	if w.period > 0 {
+		w.at = w.at.Add(w.period)
+	} else {
+		c.waiters = c.waiters[1:]
+	}
+	now := c.now
+	c.mux.Unlock()
+
+	if w.f != nil {
+		w.f()
+		return true
+	}
+	// Like time.Ticker, drop the tick if the last one wasn't read
+	select {
+	case w.ch <- now:
+	default:
+	}
+	return true
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mux.Lock()
+	defer w.clock.mux.Unlock()
+	return w.clock.remove(w)
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.ch }
+
+func (t fakeTicker) Stop() { t.fakeWaiter.Stop() }
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockFullSessionCycle(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.Timer.Sets = 2
+
+	room.start_protocol(host)
+	clock.Advance(1499 * time.Second)
+	if room.Timer.IsBreak || room.Timer.RemainingTime() != time.Second {
+		t.Fatalf("expected 1s of focus left, got %v", room.Timer.RemainingTime())
+	}
+
+	clock.Advance(time.Second)
+	if !room.Timer.IsBreak || room.Timer.CompletedSets != 1 || room.Timer.RemainingTime() != 300*time.Second {
+		t.Fatalf("expected a short break after focus: %+v", room.Timer.config())
+	}
+
+	clock.Advance(300 * time.Second)
+	if room.Timer.IsBreak || room.Timer.RemainingTime() != 1500*time.Second {
+		t.Fatal("expected focus time after the short break")
+	}
+
+	clock.Advance(1500 * time.Second)
+	if !room.Timer.IsCompleted || room.Timer.CompletedSets != 2 {
+		t.Fatal("expected the session to complete after the last set")
+	}
+	waitForProtocol(t, host, "endModal")
+}
+
+func TestUpdateIntervalHasAFloor(t *testing.T) {
+	timer := &Timer{Pace: 2.0}
+	if got := timer.updateInterval(); got != 18*time.Second {
+		t.Fatalf("expected 18s at pace 2, got %v", got)
+	}
+	timer.Pace = 1000
+	if got := timer.updateInterval(); got != 36*time.Millisecond {
+		t.Fatalf("expected 36ms at pace 1000, got %v", got)
+	}
+	timer.Pace = 1e9
+	if got := timer.updateInterval(); got != minUpdateInterval {
+		t.Fatalf("expected the minimum interval, got %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLongBreakEveryNSets(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+
+	err := room.updateConfig_protocol(host, "", map[string]interface{}{"longBreakEvery": 2, "cycles": 2, "phase": "focus"}, nil, nil)
+	if err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if room.Timer.Sets != 4 || room.Timer.Phase != "" {
+		t.Fatalf("expected 4 sets and no phase change, got %d sets in %q", room.Timer.Sets, room.Timer.Phase)
+	}
+
+	want := []Phase{PhaseFocus, PhaseShortBreak, PhaseFocus, PhaseLongBreak, PhaseFocus, PhaseShortBreak, PhaseFocus}
+	schedule := room.Timer.plannedSchedule()
+	if len(schedule) != len(want) {
+		t.Fatalf("expected %d steps, got %+v", len(want), schedule)
+	}
+	for i, step := range schedule {
+		if step.Phase != want[i] {
+			t.Fatalf("step %d: expected %s, got %s", i, want[i], step.Phase)
+		}
+	}
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	for i, step := range schedule {
+		if room.Timer.Phase != step.Phase {
+			t.Fatalf("step %d: timer in %s, expected %s", i, room.Timer.Phase, step.Phase)
+		}
+		clock.Advance(time.Duration(step.Duration) * time.Second)
+	}
+	if room.Timer.Phase != PhaseAwaitingDecision || room.Timer.CompletedSets != 4 {
+		t.Fatalf("expected the end modal after 4 sets, got %s", room.Timer.Phase)
+	}
+}
+
+func TestAutoContinueRepeatsTheCycle(t *testing.T) {
+	timer := &Timer{Sets: 4, LongBreakEvery: 2, AutoContinue: true}
+	want := []Phase{PhaseShortBreak, PhaseLongBreak, PhaseShortBreak, PhaseLongBreak, PhaseShortBreak, PhaseLongBreak}
+	for i, phase := range want {
+		if got := timer.breakAfter(uint8(i + 1)); got != phase {
+			t.Fatalf("after set %d: expected %s, got %s", i+1, phase, got)
+		}
+	}
+}
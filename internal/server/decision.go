@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// Decisions the end modal offers, and the room's default when nobody decides.
+const (
+	DecisionEnd          = "end"
+	DecisionExtraSet     = "extraSet"
+	DecisionExtraSession = "extraSession"
+)
+
+// DefaultDecisionTimeout is how long the end modal waits when the room
+// doesn't set decisionTimeout.
+const DefaultDecisionTimeout = 2 * time.Minute
+
+const maxDecisionTimeout = 3600 // Seconds
+
+// decisionPolicy returns how long the end modal waits and what happens then.
+func (r *Room) decisionPolicy() (time.Duration, string) {
+	r.ConfigMux.RLock()
+	defer r.ConfigMux.RUnlock()
+	timeout := DefaultDecisionTimeout
+	if r.Config.DecisionTimeout > 0 {
+		timeout = time.Duration(r.Config.DecisionTimeout) * time.Second
+	}
+	action := r.Config.DecisionDefault
+	if action == "" {
+		action = DecisionEnd
+	}
+	return timeout, action
+}
+
+// armDecision opens the end modal's decision window and returns when it
+// closes and the action taken then.
+func (r *Room) armDecision() (time.Time, string) {
+	timeout, action := r.decisionPolicy()
+	deadline := r.clock().Now().Add(timeout)
+
+	r.decisionMux.Lock()
+	defer r.decisionMux.Unlock()
+	if r.decisionTimer != nil {
+		r.decisionTimer.Stop()
+	}
+	r.decisionDeadline = deadline
+	r.decisionTimer = r.clock().AfterFunc(timeout, func() {
+		r.enqueue("decisionExpired", map[string]interface{}{"deadline": deadline})
+	})
+	return deadline, action
+}
+
+// cancelDecision closes the decision window once someone decided.
+func (r *Room) cancelDecision() {
+	r.decisionMux.Lock()
+	defer r.decisionMux.Unlock()
+	if r.decisionTimer != nil {
+		r.decisionTimer.Stop()
+		r.decisionTimer = nil
+	}
+	r.decisionDeadline = time.Time{}
+}
+
+// decisionExpired takes the room's default action when nobody decided by
+// deadline. It runs on the room goroutine, queued by armDecision.
+func (r *Room) decisionExpired(deadline time.Time) {
+	r.decisionMux.Lock()
+	if !r.decisionDeadline.Equal(deadline) {
+		// Decided or reopened while this timer fired
+		r.decisionMux.Unlock()
+		return
+	}
+	r.decisionTimer = nil
+	r.decisionDeadline = time.Time{}
+	r.decisionMux.Unlock()
+	if r.isClosed() {
+		return
+	}
+
+	_, action := r.decisionPolicy()
+	fmt.Printf("Nobody decided in room %s, taking the default action %s\n", r.Id, action)
+	var err error
+	switch action {
+	case DecisionExtraSet:
+		err = r.extraSet_protocol(nil)
+	case DecisionExtraSession:
+		err = r.extraSession_protocol(nil)
+	default:
+		err = r.end_protocol(nil)
+	}
+	if err != nil {
+		fmt.Printf("error in decisionExpired: %v\n", err)
+		return
+	}
+	if err := r.responseFactory(action, nil); err != nil {
+		fmt.Printf("error in decisionExpired: %v\n", err)
+	}
+	r.touch()
+	r.publishLobby()
+}
+
+// canDecide reports whether h may answer the end modal: the host, or a
+// co-host while the host is gone. A nil h is the server taking the default.
+func (r *Room) canDecide(h *Client) bool {
+	if h == nil || r.isHost(h) {
+		return true
+	}
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	_, hostPresent := r.Hikers[r.Host]
+	return r.CoHosts[h.Id] && !hostPresent
+}
+
+// checkDecision refuses h's answer to the end modal unless canDecide allows it.
+func (r *Room) checkDecision(h *Client) error {
+	r.Timer.TimerMux.RLock()
+	deciding := r.Timer.currentPhase() == PhaseAwaitingDecision
+	r.Timer.TimerMux.RUnlock()
+	if deciding && !r.canDecide(h) {
+		return fmt.Errorf("Only the host, or a co-host while the host is away, can decide")
+	}
+	return nil
+}
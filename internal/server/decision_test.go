@@ -0,0 +1,70 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEndModalTakesTheDefaultAction(t *testing.T) {
+	host := newTestHiker("1")
+	guest := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, guest)
+	room.Timer.Sets = 1
+	room.Config.DecisionTimeout = 60
+	room.Config.DecisionDefault = DecisionExtraSet
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(1500 * time.Second)
+	packet := waitForProtocol(t, host, "endModal")
+	if packet.Response["decisionTimeout"] != 60.0 || packet.Response["defaultAction"] != DecisionExtraSet {
+		t.Fatalf("expected a 60s window defaulting to extraSet, got %+v", packet.Response)
+	}
+	if err := room.end_protocol(guest); err == nil {
+		t.Fatal("expected a guest to be refused")
+	}
+
+	clock.Advance(60 * time.Second)
+	runQueued(room)
+	if room.Timer.Phase != PhaseLongBreak || room.Timer.Sets != 2 {
+		t.Fatalf("expected the default extra set, got %s with %d sets", room.Timer.Phase, room.Timer.Sets)
+	}
+	waitForProtocol(t, guest, "extraSet")
+}
+
+func TestCoHostDecidesWhenHostIsGone(t *testing.T) {
+	host := newTestHiker("1")
+	coHost := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, coHost)
+	room.CoHosts = map[string]bool{coHost.Id: true}
+	room.Timer.Sets = 1
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(1500 * time.Second)
+	if room.Timer.Phase != PhaseAwaitingDecision {
+		t.Fatalf("expected the end modal, got %s", room.Timer.Phase)
+	}
+	if err := room.extraSession_protocol(coHost); err == nil {
+		t.Fatal("expected the co-host to wait for the host")
+	}
+
+	// The host drops and is within their grace period
+	room.HikersMux.Lock()
+	delete(room.Hikers, host.Id)
+	room.HikersMux.Unlock()
+	if err := room.extraSession_protocol(coHost); err != nil {
+		t.Fatalf("extraSession failed: %v", err)
+	}
+	if room.Timer.Sets != 4 {
+		t.Fatalf("expected 4 sets, got %d", room.Timer.Sets)
+	}
+	// The closed window doesn't end the session later
+	clock.Advance(900 * time.Second)
+	runQueued(room)
+	if room.Timer.Phase != PhaseFocus {
+		t.Fatalf("expected focus after the long break, got %s", room.Timer.Phase)
+	}
+}
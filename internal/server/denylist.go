@@ -0,0 +1,309 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DenyList blocks user ids, usernames and IP ranges across the whole server.
+// When it has a path every change is written back to that file.
+type DenyList struct {
+	mux       sync.RWMutex
+	path      string
+	userIds   map[string]bool
+	usernames map[string]bool // Stored lower case
+	cidrs     map[string]*net.IPNet
+}
+
+// DenyListEntries is the JSON form of a DenyList, used on disk and by the admin endpoint.
+type DenyListEntries struct {
+	UserIds   []string `json:"userIds"`
+	Usernames []string `json:"usernames"`
+	Cidrs     []string `json:"cidrs"`
+}
+
+// DenyListChange is the body of an admin request adding or removing one entry.
+// Kind is one of "userId", "username" or "cidr".
+type DenyListChange struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+func newDenyList(path string) *DenyList {
+	return &DenyList{
+		path:      path,
+		userIds:   make(map[string]bool),
+		usernames: make(map[string]bool),
+		cidrs:     make(map[string]*net.IPNet),
+	}
+}
+
+// LoadDenyList reads the deny list stored at path. A missing file yields an
+// empty list that will be created on the first change.
+func LoadDenyList(path string) (*DenyList, error) {
+	d := newDenyList(path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LoadDenyList error: %v", err)
+	}
+
+	entries := DenyListEntries{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("LoadDenyList error: %v", err)
+	}
+	for _, id := range entries.UserIds {
+		d.userIds[id] = true
+	}
+	for _, name := range entries.Usernames {
+		d.usernames[strings.ToLower(name)] = true
+	}
+	for _, cidr := range entries.Cidrs {
+		network, err := parseCidr(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("LoadDenyList error: %v", err)
+		}
+		d.cidrs[network.String()] = network
+	}
+	return d, nil
+}
+
+// parseCidr accepts a CIDR range or a single IP address.
+func parseCidr(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %q", value)
+	}
+	return network, nil
+}
+
+// Add denies value and persists the list.
+func (d *DenyList) Add(kind string, value string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	switch kind {
+	case "userId":
+		d.userIds[value] = true
+	case "username":
+		d.usernames[strings.ToLower(value)] = true
+	case "cidr":
+		network, err := parseCidr(value)
+		if err != nil {
+			return err
+		}
+		d.cidrs[network.String()] = network
+	default:
+		return fmt.Errorf("unknown deny list kind: %s", kind)
+	}
+	return d.save()
+}
+
+// Remove lifts the deny entry for value and persists the list.
+func (d *DenyList) Remove(kind string, value string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	switch kind {
+	case "userId":
+		delete(d.userIds, value)
+	case "username":
+		delete(d.usernames, strings.ToLower(value))
+	case "cidr":
+		network, err := parseCidr(value)
+		if err != nil {
+			return err
+		}
+		delete(d.cidrs, network.String())
+	default:
+		return fmt.Errorf("unknown deny list kind: %s", kind)
+	}
+	return d.save()
+}
+
+// DeniesIp reports whether ip falls inside a denied range.
+func (d *DenyList) DeniesIp(ip string) bool {
+	if d == nil {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	for _, network := range d.cidrs {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeniesClient reports whether the client's user id, username or IP is denied.
+func (d *DenyList) DeniesClient(c *Client) bool {
+	if d == nil {
+		return false
+	}
+	d.mux.RLock()
+	denied := d.userIds[c.Id] || d.usernames[strings.ToLower(c.Username)]
+	d.mux.RUnlock()
+	return denied || d.DeniesIp(c.Ip)
+}
+
+// Entries returns a sorted copy of the list.
+func (d *DenyList) Entries() DenyListEntries {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.entries()
+}
+
+func (d *DenyList) entries() DenyListEntries {
+	entries := DenyListEntries{
+		UserIds:   make([]string, 0, len(d.userIds)),
+		Usernames: make([]string, 0, len(d.usernames)),
+		Cidrs:     make([]string, 0, len(d.cidrs)),
+	}
+	for id := range d.userIds {
+		entries.UserIds = append(entries.UserIds, id)
+	}
+	for name := range d.usernames {
+		entries.Usernames = append(entries.Usernames, name)
+	}
+	for cidr := range d.cidrs {
+		entries.Cidrs = append(entries.Cidrs, cidr)
+	}
+	sort.Strings(entries.UserIds)
+	sort.Strings(entries.Usernames)
+	sort.Strings(entries.Cidrs)
+	return entries
+}
+
+// save writes the list to its file. The caller must hold mux.
+func (d *DenyList) save() error {
+	if d.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(d.entries(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("DenyList save error: %v", err)
+	}
+	// Write to a temp file first so a crash never leaves a truncated list
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("DenyList save error: %v", err)
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return fmt.Errorf("DenyList save error: %v", err)
+	}
+	return nil
+}
+
+// handleDenyList is the admin endpoint for the deny list.
+// GET lists entries, POST adds a DenyListChange and DELETE removes one.
+func (s *Server) handleDenyList(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		change := DenyListChange{}
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if r.Method == http.MethodPost {
+			err = s.DenyList.Add(change.Kind, change.Value)
+		} else {
+			err = s.DenyList.Remove(change.Kind, change.Value)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			s.disconnectDenied()
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.DenyList.Entries())
+}
+
+// disconnectDenied closes open connections whose IP is now denied, along with
+// those of room members whose user id or username is.
+func (s *Server) disconnectDenied() {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for conn := range s.Clients {
+		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err == nil && s.DenyList.DeniesIp(host) {
+			conn.Close()
+		}
+	}
+	for _, room := range s.Rooms {
+		for _, c := range room.deniedMembers(s.DenyList) {
+			c.Conn.Close()
+		}
+	}
+}
+
+// deniedMembers returns the hikers, spectators and waitlisted clients the deny
+// list matches.
+func (r *Room) deniedMembers(d *DenyList) []*Client {
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	members := make([]*Client, 0, len(r.Hikers)+len(r.Spectators)+len(r.Waitlist))
+	for _, h := range r.Hikers {
+		members = append(members, h)
+	}
+	for _, h := range r.Spectators {
+		members = append(members, h)
+	}
+	members = append(members, r.Waitlist...)
+
+	denied := []*Client{}
+	for _, c := range members {
+		if c.Conn != nil && d.DeniesClient(c) {
+			denied = append(denied, c)
+		}
+	}
+	return denied
+}
+
+// isAdmin checks the request's bearer token against AdminToken. The admin
+// endpoints are disabled while no token is configured.
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.AdminToken == "" {
+		return false
+	}
+	given := []byte(r.Header.Get("Authorization"))
+	return subtle.ConstantTimeCompare(given, []byte("Bearer "+s.AdminToken)) == 1
+}
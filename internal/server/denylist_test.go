@@ -0,0 +1,139 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDenyListMatchesAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.json")
+	denyList, err := LoadDenyList(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	if err := denyList.Add("cidr", "192.168.1.0/24"); err != nil {
+		t.Fatalf("add cidr failed: %v", err)
+	}
+	if err := denyList.Add("username", "Troll"); err != nil {
+		t.Fatalf("add username failed: %v", err)
+	}
+	if err := denyList.Add("userId", "42"); err != nil {
+		t.Fatalf("add userId failed: %v", err)
+	}
+	if err := denyList.Add("cidr", "not-an-ip"); err == nil {
+		t.Fatal("expected invalid cidr to be rejected")
+	}
+
+	reloaded, err := LoadDenyList(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	cases := []struct {
+		client *Client
+		denied bool
+	}{
+		{&Client{Id: "1", Username: "hiker", Ip: "192.168.1.20"}, true},
+		{&Client{Id: "1", Username: "troll", Ip: "10.0.0.1"}, true},
+		{&Client{Id: "42", Username: "hiker", Ip: "10.0.0.1"}, true},
+		{&Client{Id: "1", Username: "hiker", Ip: "10.0.0.1"}, false},
+	}
+	for _, c := range cases {
+		if got := reloaded.DeniesClient(c.client); got != c.denied {
+			t.Errorf("DeniesClient(%+v) = %v, want %v", c.client, got, c.denied)
+		}
+	}
+
+	if err := reloaded.Remove("cidr", "192.168.1.0/24"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if reloaded.DeniesIp("192.168.1.20") {
+		t.Fatal("expected IP to be allowed after removal")
+	}
+}
+
+func TestDenyingUserEvictsConnectedHiker(t *testing.T) {
+	s := NewServer("", 0)
+	conns := make(chan *websocket.Conn, 2)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := s.createWSConn(w, r)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	defer httpServer.Close()
+
+	wsUrl := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	trollConn, friendConn := dial(), dial()
+
+	troll, friend := newTestHiker("1"), newTestHiker("2")
+	troll.Username = "troll"
+	troll.Conn, friend.Conn = <-conns, <-conns
+	room := newTestRoom(troll, friend)
+	s.Rooms[room.Id] = room
+
+	if err := s.DenyList.Add("username", "Troll"); err != nil {
+		t.Fatalf("add username failed: %v", err)
+	}
+	s.disconnectDenied()
+
+	trollConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := trollConn.ReadMessage(); err == nil || isTimeout(err) {
+		t.Fatalf("expected the denied hiker's connection to be closed, got %v", err)
+	}
+	friendConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := friendConn.ReadMessage(); !isTimeout(err) {
+		t.Fatalf("expected the other hiker to stay connected, got %v", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+func TestIsAdminChecksBearerToken(t *testing.T) {
+	s := NewServer("", 0)
+	request := func(auth string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/admin/denylist", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		return r
+	}
+
+	if s.isAdmin(request("Bearer ")) {
+		t.Fatal("expected admin endpoints to be disabled without a token")
+	}
+	s.AdminToken = "secret"
+	cases := map[string]bool{
+		"Bearer secret":  true,
+		"Bearer secret2": false,
+		"Bearer secre":   false,
+		"secret":         false,
+		"":               false,
+	}
+	for auth, want := range cases {
+		if got := s.isAdmin(request(auth)); got != want {
+			t.Errorf("isAdmin(%q) = %v, want %v", auth, got, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultBreakRatio is the break length, as a fraction of the focus block
+// before it, when a flowtime room doesn't set breakRatio.
+const DefaultBreakRatio = 0.2
+
+const maxBreakRatio = 2
+
+// validateFlowtime checks the Flowtime and BreakRatio of a TimerConfig.
+func (c TimerConfig) validateFlowtime() error {
+	if c.BreakRatio < 0 || c.BreakRatio > maxBreakRatio {
+		return fmt.Errorf("breakRatio must be between 0 and %d", maxBreakRatio)
+	}
+	if c.Flowtime && len(c.Intervals) > 0 {
+		return fmt.Errorf("flowtime can't be used with custom intervals")
+	}
+	return nil
+}
+
+// breakRatio is BreakRatio, or DefaultBreakRatio when unset. The caller must
+// hold TimerMux.
+func (t *Timer) breakRatio() float64 {
+	if t.BreakRatio > 0 {
+		return float64(t.BreakRatio)
+	}
+	return DefaultBreakRatio
+}
+
+// flowBreak is the length of a flowtime break: breakRatio times the focus
+// block before it. A long break is longer again by as much as LongBreakTime
+// is longer than ShortBreakTime. The caller must hold TimerMux.
+func (t *Timer) flowBreak(p Phase) uint16 {
+	if p != PhaseLongBreak || t.ShortBreakTime == 0 || t.LongBreakTime <= t.ShortBreakTime {
+		return t.flowBreakTime
+	}
+	scaled := float64(t.flowBreakTime) * float64(t.LongBreakTime) / float64(t.ShortBreakTime)
+	return uint16(min(math.Round(scaled), math.MaxUint16))
+}
+
+// openEnded reports whether the phase is flowtime focus, which has no time
+// left to report, only the time it has run. The caller must hold TimerMux.
+func (t *Timer) openEnded() bool {
+	return t.Flowtime && t.currentPhase() == PhaseFocus
+}
+
+// addPhaseTime sets message's remainingTime in seconds, or elapsed during
+// flowtime focus, and returns message.
+func (t *Timer) addPhaseTime(message map[string]interface{}) map[string]interface{} {
+	t.TimerMux.RLock()
+	openEnded, elapsed := t.openEnded(), t.elapsed()
+	t.TimerMux.RUnlock()
+	if openEnded {
+		message["elapsed"] = elapsed.Seconds()
+		return message
+	}
+	message["remainingTime"] = t.RemainingTime().Seconds()
+	return message
+}
+
+// StopFocus ends an open-ended flowtime focus block with a break of
+// breakRatio times its length.
+func (t *Timer) StopFocus(r *Room) error {
+	t.TimerMux.Lock()
+	if !t.Flowtime || t.currentPhase() != PhaseFocus {
+		t.TimerMux.Unlock()
+		return fmt.Errorf("there is no flowtime focus block to stop")
+	}
+	if t.IsPaused {
+		t.TimerMux.Unlock()
+		return fmt.Errorf("the room is paused")
+	}
+	focused := t.clock().Now().Sub(t.StartTimestamp)
+	seconds := math.Round(focused.Seconds() * t.breakRatio())
+	t.flowBreakTime = uint16(max(1, min(seconds, math.MaxUint16)))
+	t.TimerMux.Unlock()
+
+	return t.SetBreak(r)
+}
+
+// stopFocus_protocol ends flowtime focus. The host or a co-host stops it for
+// the room; anyone else stops on their own, no longer accruing distance, and
+// the room stops once every hiker has.
+func (r *Room) stopFocus_protocol(h *Client) error {
+	r.Timer.TimerMux.RLock()
+	flowing := r.Timer.Flowtime && r.Timer.currentPhase() == PhaseFocus && !r.Timer.IsPaused
+	started := r.Timer.StartTimestamp
+	r.Timer.TimerMux.RUnlock()
+	if !flowing {
+		r.sendError(h, "There is no flowtime focus block to stop")
+		return fmt.Errorf("error in stopFocus_protocol: room %s is not in flowtime focus", r.Id)
+	}
+
+	// Settle the distance covered up to now
+	r.accrueMux.Lock()
+	r.accrueLocked()
+	everyone := r.isHostOrCoHost(h)
+	r.HikersMux.Lock()
+	if !everyone {
+		h.FocusStopped = true
+		everyone = true
+		for _, hiker := range r.Hikers {
+			everyone = everyone && hiker.FocusStopped
+		}
+	}
+	if everyone {
+		for _, hiker := range r.Hikers {
+			hiker.FocusStopped = false
+		}
+	}
+	r.HikersMux.Unlock()
+	r.accrueMux.Unlock()
+
+	focused := r.clock().Now().Sub(started).Round(time.Second)
+	r.audit(h, "stopFocus", map[string]interface{}{
+		"room":    everyone,
+		"focused": focused.Seconds(),
+	})
+	if !everyone {
+		return r.broadcast("focusStopped", map[string]interface{}{
+			"type":    "broadcast",
+			"userId":  h.Id,
+			"message": fmt.Sprintf("%s stopped after %s", h.Username, focused),
+		})
+	}
+	if err := r.Timer.StopFocus(r); err != nil {
+		r.sendError(h, "Cannot stop focus: "+err.Error())
+		return fmt.Errorf("error in stopFocus_protocol: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFlowtimeBreakFollowsFocus(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	other := newTestHiker("3")
+	room, clock := newClockedRoom(t, host, hiker, other)
+
+	err := room.updateConfig_protocol(host, "", map[string]interface{}{"flowtime": true, "breakRatio": 0.25}, nil, nil)
+	if err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if err := room.stopFocus_protocol(host); err == nil {
+		t.Fatal("expected stopFocus before the start to fail")
+	}
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	// Focus doesn't end on its own
+	clock.Advance(3 * time.Hour)
+	if room.Timer.Phase != PhaseFocus {
+		t.Fatalf("expected open-ended focus, got %s", room.Timer.Phase)
+	}
+
+	// Pausing the room doesn't count toward the break
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := room.resumeRoom_protocol(host); err != nil {
+		t.Fatalf("resumeRoom failed: %v", err)
+	}
+
+	// A hiker who stops no longer accrues distance
+	if err := room.stopFocus_protocol(hiker); err != nil {
+		t.Fatalf("stopFocus failed: %v", err)
+	}
+	waitForProtocol(t, host, "focusStopped")
+	clock.Advance(time.Hour)
+	if err := room.stopFocus_protocol(other); err != nil {
+		t.Fatalf("stopFocus failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseFocus {
+		t.Fatalf("expected focus to continue for the host, got %s", room.Timer.Phase)
+	}
+	if err := room.stopFocus_protocol(host); err != nil {
+		t.Fatalf("stopFocus failed: %v", err)
+	}
+
+	// 4 hours of focus at a ratio of 0.25
+	if room.Timer.Phase != PhaseShortBreak || room.Timer.Duration != time.Hour {
+		t.Fatalf("expected a 1 hour short break, got %s for %s", room.Timer.Phase, room.Timer.Duration)
+	}
+	if math.Abs(host.Distance-8) > 1e-9 || math.Abs(hiker.Distance-6) > 1e-9 || math.Abs(other.Distance-8) > 1e-9 {
+		t.Fatalf("expected 8, 6 and 8 miles, got %f, %f and %f", host.Distance, hiker.Distance, other.Distance)
+	}
+	if hiker.FocusStopped || other.FocusStopped {
+		t.Fatal("expected every hiker back in for the next focus block")
+	}
+
+	clock.Advance(time.Hour)
+	if room.Timer.Phase != PhaseFocus || room.Timer.CompletedSets != 1 {
+		t.Fatalf("expected the second focus block, got %s", room.Timer.Phase)
+	}
+	// Everyone stopping on their own ends it too
+	clock.Advance(20 * time.Minute)
+	for _, h := range []*Client{hiker, other} {
+		if err := room.stopFocus_protocol(h); err != nil {
+			t.Fatalf("stopFocus failed: %v", err)
+		}
+	}
+	room.CoHosts = nil
+	room.Host = "nobody"
+	if err := room.stopFocus_protocol(host); err != nil {
+		t.Fatalf("stopFocus failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseShortBreak || room.Timer.Duration != 5*time.Minute {
+		t.Fatalf("expected a 5 minute short break, got %s for %s", room.Timer.Phase, room.Timer.Duration)
+	}
+}
+
+func TestFlowtimeLongBreaksAndMidSessionChanges(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+
+	err := room.updateConfig_protocol(host, "", map[string]interface{}{"flowtime": true, "longBreakEvery": 2}, nil, nil)
+	if err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(50 * time.Minute)
+	if err := room.stopFocus_protocol(host); err != nil {
+		t.Fatalf("stopFocus failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseShortBreak || room.Timer.Duration != 10*time.Minute {
+		t.Fatalf("expected a 10 minute short break, got %s for %s", room.Timer.Phase, room.Timer.Duration)
+	}
+
+	// The mode can't change under a running session
+	for _, change := range []map[string]interface{}{{"flowtime": false}, {"breakRatio": 0.5}} {
+		if err := room.updateConfig_protocol(host, "", change, nil, nil); err == nil {
+			t.Fatalf("expected %v to be refused mid-session", change)
+		}
+	}
+	if !room.Timer.Flowtime || room.Timer.BreakRatio != 0 {
+		t.Fatal("a refused change was applied")
+	}
+
+	// The second set ends with a long break, 900s/300s times as long
+	clock.Advance(10 * time.Minute)
+	clock.Advance(50 * time.Minute)
+	if err := room.stopFocus_protocol(host); err != nil {
+		t.Fatalf("stopFocus failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseLongBreak || room.Timer.Duration != 30*time.Minute {
+		t.Fatalf("expected a 30 minute long break, got %s for %s", room.Timer.Phase, room.Timer.Duration)
+	}
+}
+
+func TestFlowtimeFocusSendsElapsed(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	if err := room.updateConfig_protocol(host, "", map[string]interface{}{"flowtime": true}, nil, nil); err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+
+	if err := room.responseFactory("update", host); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	update := lastPacket(t, host).Response
+	if _, ok := update["remainingTime"]; ok || update["elapsed"] != 600.0 {
+		t.Fatalf("expected 600s elapsed and no remainingTime, got %v and %v", update["elapsed"], update["remainingTime"])
+	}
+	data, err := json.Marshal(room.Timer)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var timer map[string]interface{}
+	json.Unmarshal(data, &timer)
+	if timer["elapsed"] != 600.0 {
+		t.Fatalf("expected the timer to carry 600s elapsed, got %v", timer["elapsed"])
+	}
+
+	// Time paused doesn't count
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if summary := room.summary(); summary.Elapsed != 600 || summary.RemainingTime != 0 {
+		t.Fatalf("expected the lobby to show 600s elapsed, got %+v", summary)
+	}
+}
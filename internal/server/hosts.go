@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// isHostOrCoHost reports whether h may moderate the room.
+func (r *Room) isHostOrCoHost(h *Client) bool {
+	if r.isHost(h) {
+		return true
+	}
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	return h != nil && r.CoHosts[h.Id]
+}
+
+// nextHost picks the successor when the host is gone: the longest-present
+// co-host, otherwise the longest-present hiker. The caller must hold HikersMux.
+func (r *Room) nextHost() *Client {
+	candidates := make([]*Client, 0, len(r.Hikers))
+	for _, hiker := range r.Hikers {
+		candidates = append(candidates, hiker)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if r.CoHosts[a.Id] != r.CoHosts[b.Id] {
+			return r.CoHosts[a.Id]
+		}
+		if !a.JoinedAt.Equal(b.JoinedAt) {
+			return a.JoinedAt.Before(b.JoinedAt)
+		}
+		return a.Id < b.Id
+	})
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[0]
+}
+
+// assignHost makes newHost the host and tells the room. A nil actor marks an
+// automatic election.
+func (r *Room) assignHost(newHost *Client, actor *Client) error {
+	r.cancelHostGrace()
+
+	r.HikersMux.Lock()
+	previousHost := r.Host
+	for _, hiker := range r.Hikers {
+		hiker.IsHost = hiker.Id == newHost.Id
+	}
+	r.Host = newHost.Id
+	hikersSnapshot := make(map[string]*Client, len(r.Hikers))
+	for k, v := range r.Hikers {
+		hikersSnapshot[k] = v
+	}
+	r.HikersMux.Unlock()
+
+	r.audit(actor, "hostTransfer", map[string]interface{}{
+		"from": previousHost,
+		"to":   newHost.Id,
+	})
+
+	fmt.Printf("New Host is: %s\n", newHost.Username)
+	text := fmt.Sprintf("%s is the new host", newHost.Username)
+	if actor != nil {
+		text = fmt.Sprintf("%s made %s the host", actor.Username, newHost.Username)
+	}
+	return r.broadcast("newHost", map[string]interface{}{
+		"type":    "broadcast",
+		"hikers":  hikersSnapshot,
+		"coHosts": r.coHostList(),
+		"message": text,
+	})
+}
+
+// startHostGrace holds the host spot for the disconnected host. If it has not
+// rejoined when the grace period ends a successor is elected on the room
+// goroutine.
+func (r *Room) startHostGrace(h *Client) {
+	hostId := h.Id
+	r.hostGraceMux.Lock()
+	if r.hostGrace != nil {
+		r.hostGrace.Stop()
+	}
+	at := r.clock().Now().Add(r.HostGracePeriod)
+	r.hostGraceAt = at
+	r.hostGrace = r.clock().AfterFunc(r.HostGracePeriod, func() {
+		r.enqueue("hostGraceExpired", map[string]interface{}{"at": at, "hostId": hostId})
+	})
+	r.hostGraceMux.Unlock()
+
+	r.broadcast("hostAway", map[string]interface{}{
+		"type":        "broadcast",
+		"message":     fmt.Sprintf("%s lost connection, waiting for them to return", h.Username),
+		"gracePeriod": r.HostGracePeriod.Seconds(),
+	})
+}
+
+// hostGraceExpired runs on the room goroutine when the grace period that ends
+// at at is over, electing a successor unless hostId came back.
+func (r *Room) hostGraceExpired(at time.Time, hostId string) {
+	r.hostGraceMux.Lock()
+	if r.hostGrace == nil || !r.hostGraceAt.Equal(at) {
+		// Cancelled or restarted while this grace period ended
+		r.hostGraceMux.Unlock()
+		return
+	}
+	r.hostGrace = nil
+	r.hostGraceMux.Unlock()
+
+	r.HikersMux.RLock()
+	_, returned := r.Hikers[hostId]
+	stillHost := r.Host == hostId
+	r.HikersMux.RUnlock()
+	if stillHost && !returned {
+		r.setNewHost()
+		r.publishLobby()
+	}
+}
+
+// cancelHostGrace stops a pending host election.
+func (r *Room) cancelHostGrace() {
+	r.hostGraceMux.Lock()
+	defer r.hostGraceMux.Unlock()
+	if r.hostGrace != nil {
+		r.hostGrace.Stop()
+		r.hostGrace = nil
+	}
+}
+
+func (r *Room) coHostList() []string {
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	coHosts := make([]string, 0, len(r.CoHosts))
+	for id := range r.CoHosts {
+		coHosts = append(coHosts, id)
+	}
+	sort.Strings(coHosts)
+	return coHosts
+}
+
+// transferHost_protocol lets the host hand the room to another hiker.
+func (r *Room) transferHost_protocol(h *Client, targetId string) error {
+	if !r.isHost(h) {
+		r.sendError(h, "Only the host can transfer the host role")
+		return fmt.Errorf("error in transferHost_protocol: %s is not the host", h.Id)
+	}
+	r.HikersMux.RLock()
+	target, ok := r.Hikers[targetId]
+	r.HikersMux.RUnlock()
+	if !ok || target.Id == h.Id {
+		r.sendError(h, "Hiker is not in this room")
+		return fmt.Errorf("error in transferHost_protocol: hiker %s not found", targetId)
+	}
+	return r.assignHost(target, h)
+}
+
+// coHost_protocol lets the host appoint or dismiss a co-host. Co-hosts can
+// moderate and are first in line if the host leaves.
+func (r *Room) coHost_protocol(h *Client, targetId string, appoint bool) error {
+	if !r.isHost(h) {
+		r.sendError(h, "Only the host can change co-hosts")
+		return fmt.Errorf("error in coHost_protocol: %s is not the host", h.Id)
+	}
+
+	r.HikersMux.Lock()
+	target, ok := r.Hikers[targetId]
+	if !ok || target.Id == h.Id {
+		r.HikersMux.Unlock()
+		r.sendError(h, "Hiker is not in this room")
+		return fmt.Errorf("error in coHost_protocol: hiker %s not found", targetId)
+	}
+	if r.CoHosts == nil {
+		r.CoHosts = make(map[string]bool)
+	}
+	if appoint {
+		r.CoHosts[targetId] = true
+	} else {
+		delete(r.CoHosts, targetId)
+	}
+	target.IsCoHost = appoint
+	hikersSnapshot := make(map[string]*Client, len(r.Hikers))
+	for k, v := range r.Hikers {
+		hikersSnapshot[k] = v
+	}
+	r.HikersMux.Unlock()
+
+	action := "addCoHost"
+	text := fmt.Sprintf("%s is now a co-host", target.Username)
+	if !appoint {
+		action = "removeCoHost"
+		text = fmt.Sprintf("%s is no longer a co-host", target.Username)
+	}
+	r.audit(h, action, map[string]interface{}{"userId": targetId})
+
+	return r.broadcast("coHosts", map[string]interface{}{
+		"type":    "broadcast",
+		"hikers":  hikersSnapshot,
+		"coHosts": r.coHostList(),
+		"message": text,
+	})
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostSuccessionPrefersCoHostsThenSeniority(t *testing.T) {
+	host := newTestHiker("1")
+	room := newTestRoom(host)
+	veteran := newTestHiker("9")
+	newcomer := newTestHiker("2")
+	for _, h := range []*Client{veteran, newcomer} {
+		if err := room.join_protocol(h); err != nil {
+			t.Fatalf("join failed: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	room.leave_protocol(host)
+	if room.Host != veteran.Id {
+		t.Fatalf("expected longest-present hiker %s to be host, got %s", veteran.Id, room.Host)
+	}
+
+	third := newTestHiker("3")
+	if err := room.join_protocol(third); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	if err := room.coHost_protocol(veteran, third.Id, true); err != nil {
+		t.Fatalf("addCoHost failed: %v", err)
+	}
+	room.leave_protocol(veteran)
+	if room.Host != third.Id || !third.IsHost || newcomer.IsHost {
+		t.Fatalf("expected co-host %s to be host, got %s", third.Id, room.Host)
+	}
+
+	if err := room.transferHost_protocol(newcomer, third.Id); err == nil {
+		t.Fatal("expected transfer by non-host to fail")
+	}
+	if err := room.transferHost_protocol(third, newcomer.Id); err != nil {
+		t.Fatalf("transferHost failed: %v", err)
+	}
+	if room.Host != newcomer.Id || third.IsHost {
+		t.Fatalf("expected %s to be host after transfer, got %s", newcomer.Id, room.Host)
+	}
+}
+
+func TestHostReconnectsWithinGracePeriod(t *testing.T) {
+	host := newTestHiker("1")
+	other := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, other)
+	room.HostGracePeriod = time.Minute
+
+	room.RemoveHiker(host)
+	if room.Host != host.Id {
+		t.Fatal("host replaced before the grace period ended")
+	}
+
+	returning := newTestHiker("1")
+	if err := room.join_protocol(returning); err != nil {
+		t.Fatalf("rejoin failed: %v", err)
+	}
+	clock.Advance(2 * time.Minute)
+	runQueued(room)
+	if room.Host != host.Id || !returning.IsHost {
+		t.Fatalf("expected returning host to keep the role, got %s", room.Host)
+	}
+
+	room.RemoveHiker(returning)
+	clock.Advance(time.Minute)
+	if room.Host != host.Id {
+		t.Fatal("host elected off the room goroutine")
+	}
+	runQueued(room)
+	if room.Host != other.Id {
+		t.Fatalf("expected %s to be elected after grace period, got %s", other.Id, room.Host)
+	}
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Interval is one phase of a custom schedule. A room with Intervals runs
+// through them in order instead of FocusTime, ShortBreakTime, LongBreakTime
+// and Sets.
+type Interval struct {
+	Kind     Phase   `json:"kind"`     // PhaseFocus, PhaseShortBreak or PhaseLongBreak
+	Duration uint16  `json:"duration"` // Seconds
+	Label    string  `json:"label,omitempty"`
+	Pace     float32 `json:"pace,omitempty"` // Overrides the timer's Pace when positive
+}
+
+const (
+	maxIntervals        = 64
+	maxIntervalLength   = 4 * 60 * 60 // Seconds
+	maxIntervalLabelLen = 40
+)
+
+func (iv Interval) validate() error {
+	if iv.Kind != PhaseFocus && !iv.Kind.isBreak() {
+		return fmt.Errorf("interval kind must be %s, %s or %s", PhaseFocus, PhaseShortBreak, PhaseLongBreak)
+	}
+	if iv.Duration == 0 || iv.Duration > maxIntervalLength {
+		return fmt.Errorf("interval duration must be between 1 and %d seconds", maxIntervalLength)
+	}
+	if len([]rune(iv.Label)) > maxIntervalLabelLen {
+		return fmt.Errorf("interval label must be at most %d characters", maxIntervalLabelLen)
+	}
+	if iv.Pace < 0 {
+		return fmt.Errorf("interval pace cannot be negative")
+	}
+	return nil
+}
+
+// validateIntervals checks intervals that will run after phase prev. Focus
+// and breaks must alternate, so the list starts with focus unless prev is a
+// focus block.
+func validateIntervals(intervals []Interval, prev Phase) error {
+	for i, iv := range intervals {
+		if err := iv.validate(); err != nil {
+			return fmt.Errorf("interval %d: %v", i, err)
+		}
+		if (iv.Kind == PhaseFocus) == (prev == PhaseFocus) {
+			return fmt.Errorf("interval %d: focus and break intervals must alternate", i)
+		}
+		prev = iv.Kind
+	}
+	return nil
+}
+
+// focusCount is how many focus blocks intervals hold.
+func focusCount(intervals []Interval) int {
+	count := 0
+	for _, iv := range intervals {
+		if iv.Kind == PhaseFocus {
+			count++
+		}
+	}
+	return count
+}
+
+// setIntervals replaces the custom schedule, with Sets counting its focus
+// blocks. The caller must hold TimerMux.
+func (t *Timer) setIntervals(intervals []Interval) {
+	t.Intervals = slices.Clone(intervals)
+	if len(t.Intervals) > 0 {
+		t.Sets = uint8(min(focusCount(t.Intervals), math.MaxUint8))
+	}
+}
+
+// currentInterval returns the custom interval the timer is on, if any. The
+// caller must hold TimerMux.
+func (t *Timer) currentInterval() (Interval, bool) {
+	if t.IntervalIndex < 0 || t.IntervalIndex >= len(t.Intervals) {
+		return Interval{}, false
+	}
+	return t.Intervals[t.IntervalIndex], true
+}
+
+// nextInterval picks the phase after the current custom interval and its
+// index. Past the last interval comes the end modal, or with AutoContinue a
+// long break after a focus block and then the list from the top. The caller
+// must hold TimerMux.
+func (t *Timer) nextInterval() (Phase, int) {
+	next := t.IntervalIndex + 1
+	switch {
+	case t.IntervalIndex >= len(t.Intervals):
+		// The long break between rounds
+		return PhaseFocus, 0
+	case next < len(t.Intervals):
+		return t.Intervals[next].Kind, next
+	case t.AutoContinue && t.currentPhase() == PhaseFocus:
+		return PhaseLongBreak, len(t.Intervals)
+	case t.AutoContinue:
+		return PhaseFocus, 0
+	default:
+		return PhaseAwaitingDecision, t.IntervalIndex
+	}
+}
+
+// effectivePace is the current interval's pace override, or Pace. The caller
+// must hold TimerMux.
+func (t *Timer) effectivePace() float32 {
+	if iv, ok := t.currentInterval(); ok && iv.Kind == t.currentPhase() && iv.Pace > 0 {
+		return iv.Pace
+	}
+	return t.Pace
+}
+
+// appendSets adds sets focus blocks to the custom schedule, with short breaks
+// between them and a long break first unless the schedule already ends on a
+// break. Each repeats the last focus interval. The caller must hold TimerMux.
+func (t *Timer) appendSets(sets uint8) error {
+	focus := Interval{Kind: PhaseFocus, Duration: t.FocusTime}
+	for i := len(t.Intervals) - 1; i >= 0; i-- {
+		if t.Intervals[i].Kind == PhaseFocus {
+			focus = t.Intervals[i]
+			break
+		}
+	}
+	intervals := slices.Clone(t.Intervals)
+	if len(intervals) > 0 && intervals[len(intervals)-1].Kind == PhaseFocus {
+		intervals = append(intervals, Interval{Kind: PhaseLongBreak, Duration: t.LongBreakTime})
+	}
+	for i := uint8(0); i < sets; i++ {
+		if i > 0 {
+			intervals = append(intervals, Interval{Kind: PhaseShortBreak, Duration: t.ShortBreakTime})
+		}
+		intervals = append(intervals, focus)
+	}
+	if len(intervals) > maxIntervals {
+		return fmt.Errorf("a schedule can have at most %d intervals", maxIntervals)
+	}
+	if err := validateIntervals(intervals, PhaseIdle); err != nil {
+		return err
+	}
+	t.setIntervals(intervals)
+	return nil
+}
+
+// editIntervals replaces the upcoming part of the custom schedule with what
+// edit returns. Intervals already run, and the one running, can't change.
+// edit gets the index of the first upcoming interval in Intervals.
+func (t *Timer) editIntervals(edit func(first int, upcoming []Interval) ([]Interval, error)) error {
+	t.TimerMux.Lock()
+	defer t.TimerMux.Unlock()
+	if len(t.Intervals) == 0 {
+		return fmt.Errorf("the room has no custom intervals")
+	}
+	phase := t.currentPhase()
+	if phase == PhaseAwaitingDecision {
+		return fmt.Errorf("every interval is done, add sets instead")
+	}
+	first, prev := 0, PhaseIdle
+	if phase == PhaseFocus || phase.isBreak() {
+		prev = phase
+		if t.IntervalIndex < len(t.Intervals) {
+			first = t.IntervalIndex + 1
+		}
+	}
+
+	upcoming, err := edit(first, slices.Clone(t.Intervals[first:]))
+	if err != nil {
+		return err
+	}
+	if err := validateIntervals(upcoming, prev); err != nil {
+		return err
+	}
+	intervals := append(slices.Clone(t.Intervals[:first]), upcoming...)
+	if len(intervals) == 0 {
+		return fmt.Errorf("cannot remove every interval")
+	}
+	if len(intervals) > maxIntervals {
+		return fmt.Errorf("a schedule can have at most %d intervals", maxIntervals)
+	}
+	if focusCount(intervals) > math.MaxUint8 {
+		return fmt.Errorf("a schedule can have at most %d focus intervals", math.MaxUint8)
+	}
+	t.setIntervals(intervals)
+	return nil
+}
+
+// InsertIntervals adds intervals at index at of the custom schedule.
+func (t *Timer) InsertIntervals(at int, intervals []Interval) error {
+	return t.editIntervals(func(first int, upcoming []Interval) ([]Interval, error) {
+		i := at - first
+		if i < 0 || i > len(upcoming) {
+			return nil, fmt.Errorf("intervals can only be inserted at %d to %d", first, first+len(upcoming))
+		}
+		return slices.Insert(upcoming, i, intervals...), nil
+	})
+}
+
+// RemoveIntervals drops count intervals starting at index at.
+func (t *Timer) RemoveIntervals(at int, count int) error {
+	return t.editIntervals(func(first int, upcoming []Interval) ([]Interval, error) {
+		i := at - first
+		if i < 0 || count < 1 || i+count > len(upcoming) {
+			return nil, fmt.Errorf("only upcoming intervals %d to %d can be removed", first, first+len(upcoming)-1)
+		}
+		return slices.Delete(upcoming, i, i+count), nil
+	})
+}
+
+// MoveIntervals moves count intervals starting at index from so the first of
+// them ends up at index to.
+func (t *Timer) MoveIntervals(from int, count int, to int) error {
+	return t.editIntervals(func(first int, upcoming []Interval) ([]Interval, error) {
+		i := from - first
+		if i < 0 || count < 1 || i+count > len(upcoming) {
+			return nil, fmt.Errorf("only upcoming intervals %d to %d can be moved", first, first+len(upcoming)-1)
+		}
+		moved := slices.Clone(upcoming[i : i+count])
+		rest := slices.Delete(upcoming, i, i+count)
+		j := to - first
+		if j < 0 || j > len(rest) {
+			return nil, fmt.Errorf("intervals can only be moved to %d to %d", first, first+len(rest))
+		}
+		return slices.Insert(rest, j, moved...), nil
+	})
+}
+
+// editIntervals_protocol lets the host or a co-host insert, remove or move
+// upcoming intervals of a custom schedule, mid-session included.
+func (r *Room) editIntervals_protocol(h *Client, op string, index int, count int, to int, intervals interface{}) error {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host or a co-host can edit the intervals")
+		return fmt.Errorf("error in editIntervals_protocol: %s is not the host or a co-host", h.Id)
+	}
+	if count == 0 {
+		count = 1
+	}
+	r.Timer.TimerMux.RLock()
+	before := slices.Clone(r.Timer.Intervals)
+	r.Timer.TimerMux.RUnlock()
+
+	var err error
+	switch op {
+	case "insert":
+		var inserted []Interval
+		jsonResult, jsonErr := json.Marshal(intervals)
+		if jsonErr == nil {
+			jsonErr = json.Unmarshal(jsonResult, &inserted)
+		}
+		if jsonErr != nil || len(inserted) == 0 {
+			err = fmt.Errorf("insert needs a list of intervals")
+			break
+		}
+		err = r.Timer.InsertIntervals(index, inserted)
+	case "remove":
+		err = r.Timer.RemoveIntervals(index, count)
+	case "move":
+		err = r.Timer.MoveIntervals(index, count, to)
+	default:
+		err = fmt.Errorf("unknown op %q, use insert, remove or move", op)
+	}
+	if err != nil {
+		r.sendError(h, "Cannot edit intervals: "+err.Error())
+		return fmt.Errorf("error in editIntervals_protocol: %v", err)
+	}
+
+	r.Timer.TimerMux.Lock()
+	r.Timer.Preset = ""
+	after := slices.Clone(r.Timer.Intervals)
+	r.Timer.TimerMux.Unlock()
+	r.audit(h, "editIntervals", map[string]interface{}{
+		"op":     op,
+		"before": before,
+		"after":  after,
+	})
+	return r.broadcast("intervalsChanged", map[string]interface{}{
+		"type":    "broadcast",
+		"op":      op,
+		"timer":   r.Timer,
+		"message": fmt.Sprintf("%s changed the intervals", h.Username),
+	})
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCustomIntervalsRunInOrder(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+
+	intervals := []interface{}{
+		map[string]interface{}{"kind": "focus", "duration": 3000, "label": "Write"},
+		map[string]interface{}{"kind": "shortBreak", "duration": 600},
+		map[string]interface{}{"kind": "focus", "duration": 3000, "pace": 3},
+		map[string]interface{}{"kind": "shortBreak", "duration": 600},
+		map[string]interface{}{"kind": "focus", "duration": 1500},
+		map[string]interface{}{"kind": "longBreak", "duration": 1800},
+	}
+	err := room.updateConfig_protocol(host, "", map[string]interface{}{"intervals": intervals}, nil, nil)
+	if err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if room.Timer.Sets != 3 || room.Timer.Duration != 3000*time.Second {
+		t.Fatalf("expected 3 sets previewing 3000s, got %d sets and %s", room.Timer.Sets, room.Timer.Duration)
+	}
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	for i, step := range room.Timer.plannedSchedule() {
+		if room.Timer.Phase != step.Phase || room.Timer.IntervalIndex != i || room.Timer.Duration.Seconds() != step.Duration {
+			t.Fatalf("interval %d: timer in %s for %s, expected %+v", i, room.Timer.Phase, room.Timer.Duration, step)
+		}
+		if i == 2 && room.Timer.updateInterval() != 12*time.Second {
+			t.Fatalf("expected the pace override to set the update interval, got %s", room.Timer.updateInterval())
+		}
+		clock.Advance(time.Duration(step.Duration) * time.Second)
+	}
+	if room.Timer.Phase != PhaseAwaitingDecision || room.Timer.CompletedSets != 3 {
+		t.Fatalf("expected the end modal after the last break, got %s after %d sets", room.Timer.Phase, room.Timer.CompletedSets)
+	}
+
+	// The schedule ended on a break, so an extra set repeats the last focus
+	// interval right away
+	if err := room.extraSet_protocol(host); err != nil {
+		t.Fatalf("extraSet failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseFocus || room.Timer.IntervalIndex != 6 || len(room.Timer.Intervals) != 7 || room.Timer.Sets != 4 {
+		t.Fatalf("expected a fourth focus block, got %s with %+v", room.Timer.Phase, room.Timer.Intervals)
+	}
+	if room.Timer.Duration != 1500*time.Second {
+		t.Fatalf("expected a 1500s focus block, got %s", room.Timer.Duration)
+	}
+	if err := validateIntervals(room.Timer.Intervals, PhaseIdle); err != nil {
+		t.Fatalf("extended schedule doesn't alternate: %v", err)
+	}
+}
+
+func TestExtraSetsAfterFocusInterval(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.Timer.LongBreakTime = 0
+	room.Timer.applyConfig(TimerConfig{Pace: 2, Intervals: []Interval{{Kind: PhaseFocus, Duration: 60}}})
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	// Replacing the schedule mid-session is refused and keeps the preset
+	room.Timer.Preset = "Sprint"
+	replacement := []interface{}{map[string]interface{}{"kind": "focus", "duration": 30}}
+	err := room.updateConfig_protocol(host, "", map[string]interface{}{"intervals": replacement}, nil, nil)
+	if err == nil || room.Timer.Preset != "Sprint" || room.Timer.Intervals[0].Duration != 60 {
+		t.Fatalf("expected the refused change to leave the timer alone, got %v with preset %q", err, room.Timer.Preset)
+	}
+
+	clock.Advance(time.Minute)
+	if err := room.extraSet_protocol(host); err == nil {
+		t.Fatal("expected an extra set without a long break length to fail")
+	}
+	if room.Timer.Phase != PhaseAwaitingDecision || len(room.Timer.Intervals) != 1 {
+		t.Fatalf("a refused extra set changed the schedule: %s with %+v", room.Timer.Phase, room.Timer.Intervals)
+	}
+
+	room.Timer.LongBreakTime = 120
+	room.Timer.ShortBreakTime = 30
+	if err := room.extraSession_protocol(host); err != nil {
+		t.Fatalf("extraSession failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseLongBreak || room.Timer.Duration != 2*time.Minute || len(room.Timer.Intervals) != 7 {
+		t.Fatalf("expected a 2 minute long break before three sets, got %s with %+v", room.Timer.Phase, room.Timer.Intervals)
+	}
+	if err := validateIntervals(room.Timer.Intervals, PhaseIdle); err != nil {
+		t.Fatalf("extended schedule doesn't alternate: %v", err)
+	}
+}
+
+func TestEditUpcomingIntervals(t *testing.T) {
+	host := newTestHiker("1")
+	guest := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, guest)
+
+	room.Timer.applyConfig(TimerConfig{Pace: 2, Intervals: []Interval{
+		{Kind: PhaseFocus, Duration: 60, Label: "A"},
+		{Kind: PhaseShortBreak, Duration: 10},
+		{Kind: PhaseFocus, Duration: 120, Label: "B"},
+	}})
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	if err := room.editIntervals_protocol(guest, "remove", 1, 2, 0, nil); err == nil {
+		t.Fatal("expected a guest to be refused")
+	}
+	if err := room.editIntervals_protocol(host, "remove", 0, 1, 0, nil); err == nil {
+		t.Fatal("expected the running interval to be locked")
+	}
+	if err := room.editIntervals_protocol(host, "insert", 3, 0, 0, []interface{}{map[string]interface{}{"kind": "focus", "duration": 30}}); err == nil {
+		t.Fatal("expected two focus intervals in a row to be refused")
+	}
+
+	inserted := []interface{}{
+		map[string]interface{}{"kind": "longBreak", "duration": 20},
+		map[string]interface{}{"kind": "focus", "duration": 30, "label": "C"},
+	}
+	if err := room.editIntervals_protocol(host, "insert", 3, 0, 0, inserted); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	// Run C before B
+	if err := room.editIntervals_protocol(host, "move", 3, 2, 1, nil); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	waitForProtocol(t, host, "intervalsChanged")
+	if packet := waitForProtocol(t, host, "intervalsChanged"); packet.Response["op"] != "move" {
+		t.Fatalf("expected an intervalsChanged broadcast, got %+v", packet.Response)
+	}
+
+	want := []string{"A", "", "C", "", "B"}
+	for i, label := range want {
+		if room.Timer.Intervals[i].Label != label {
+			t.Fatalf("interval %d: expected %q, got %+v", i, label, room.Timer.Intervals)
+		}
+	}
+	clock.Advance(60 * time.Second)
+	if room.Timer.Phase != PhaseLongBreak || room.Timer.Duration != 20*time.Second {
+		t.Fatalf("expected the moved long break, got %s for %s", room.Timer.Phase, room.Timer.Duration)
+	}
+	clock.Advance(20 * time.Second)
+	if iv, _ := room.Timer.currentInterval(); room.Timer.Phase != PhaseFocus || iv.Label != "C" {
+		t.Fatalf("expected focus C, got %s %+v", room.Timer.Phase, iv)
+	}
+}
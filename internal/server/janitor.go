@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// RoomLimits bound how long a room may live. A zero limit is not enforced.
+type RoomLimits struct {
+	IdleTimeout      time.Duration // No messages and no timer activity
+	MaxLifetime      time.Duration // Since the room was created
+	CompletedTimeout time.Duration // Waiting on the end-of-session modal
+}
+
+// touch records room activity for the idle timeout.
+func (r *Room) touch() {
+	r.lastActivity.Store(r.clock().Now().UnixNano())
+}
+
+func (r *Room) isClosed() bool {
+	r.lobbyMux.Lock()
+	defer r.lobbyMux.Unlock()
+	return r.closed
+}
+
+// expiryReason returns why the room should be expired at now, or "" if it may live on.
+func (r *Room) expiryReason(limits RoomLimits, now time.Time) string {
+	if r.isClosed() {
+		return "closed"
+	}
+	if r.Persistent {
+		// Persistent rooms reset when empty and are only removed by their owner
+		return ""
+	}
+	// A room waiting on its scheduled start is not idle, and its lifetime
+	// counts from the scheduled start
+	scheduledStart := r.scheduledStart()
+	bornAt := r.CreatedAt
+	if scheduledStart != nil && scheduledStart.After(bornAt) {
+		bornAt = *scheduledStart
+	}
+	if limits.MaxLifetime > 0 && !bornAt.IsZero() && now.Sub(bornAt) > limits.MaxLifetime {
+		return "This room reached its maximum lifetime"
+	}
+	if limits.IdleTimeout > 0 && scheduledStart == nil {
+		lastActivity := time.Unix(0, r.lastActivity.Load())
+		if r.lastActivity.Load() != 0 && now.Sub(lastActivity) > limits.IdleTimeout {
+			return "This room was closed for inactivity"
+		}
+	}
+	if limits.CompletedTimeout > 0 {
+		r.Timer.TimerMux.RLock()
+		completedAt := r.Timer.CompletedAt
+		completed := r.Timer.IsCompleted
+		r.Timer.TimerMux.RUnlock()
+		if completed && now.Sub(completedAt) > limits.CompletedTimeout {
+			return "This session finished and was closed"
+		}
+	}
+	return ""
+}
+
+// expire stops the room's timer, tells anyone still inside why the room is
+// closing and shuts down its goroutines.
+func (r *Room) expire(reason string) {
+	r.Timer.Stop()
+	r.cancelHostGrace()
+
+	r.broadcast("roomExpired", map[string]interface{}{
+		"type":    "broadcast",
+		"message": reason,
+	})
+	for _, c := range r.recipients() {
+		c.setRoomId("")
+	}
+	r.HikersMux.Lock()
+	for _, waiting := range r.Waitlist {
+		waiting.setRoomId("")
+	}
+	r.Waitlist = nil
+	r.HikersMux.Unlock()
+
+	r.close()
+}
+
+// sweepRooms expires every room past one of the server's RoomLimits.
+func (s *Server) sweepRooms(now time.Time) {
+	s.mux.RLock()
+	rooms := make([]*Room, 0, len(s.Rooms))
+	for _, room := range s.Rooms {
+		rooms = append(rooms, room)
+	}
+	s.mux.RUnlock()
+
+	for _, room := range rooms {
+		reason := room.expiryReason(s.RoomLimits, now)
+		if reason == "" {
+			continue
+		}
+		if reason != "closed" {
+			fmt.Printf("Expiring room %s: %s\n", room.Id, reason)
+			room.expire(reason)
+		}
+		s.mux.Lock()
+		delete(s.Rooms, room.Id)
+		s.mux.Unlock()
+	}
+}
+
+// runJanitor sweeps rooms every JanitorInterval until quit is closed.
+func (s *Server) runJanitor(quit chan struct{}) {
+	ticker := s.clock().NewTicker(s.JanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			s.sweepRooms(now)
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJanitorExpiresIdleRooms(t *testing.T) {
+	s := NewServer("", 0)
+	host := newTestHiker("1")
+	idle := newTestRoom(host)
+	idle.CreatedAt = time.Now()
+	idle.touch()
+	s.Rooms[idle.Id] = idle
+
+	busy := newTestRoom(newTestHiker("2"))
+	busy.Id = "room2"
+	busy.CreatedAt = time.Now()
+	s.Rooms[busy.Id] = busy
+
+	idle.Timer.BeginFocusTime(idle)
+	later := time.Now().Add(s.RoomLimits.IdleTimeout + time.Minute)
+	busy.lastActivity.Store(later.UnixNano())
+
+	s.sweepRooms(later)
+
+	if _, ok := s.Rooms[idle.Id]; ok {
+		t.Fatal("idle room was not removed")
+	}
+	if _, ok := s.Rooms[busy.Id]; !ok {
+		t.Fatal("active room was removed")
+	}
+	if packet := lastPacket(t, host); packet.Header.Protocol != "roomExpired" {
+		t.Fatalf("expected roomExpired notice, got %s", packet.Header.Protocol)
+	}
+	if host.RoomId != "" {
+		t.Fatal("expired room still referenced by hiker")
+	}
+	if idle.Timer.IsRunning {
+		t.Fatal("expired room timer still running")
+	}
+	if _, open := <-idle.IncomingMsgs; open {
+		t.Fatal("expired room still accepting messages")
+	}
+}
+
+func TestJanitorExpiresCompletedRooms(t *testing.T) {
+	room := newTestRoom(newTestHiker("1"))
+	room.CreatedAt = time.Now()
+	room.touch()
+	room.Timer.IsCompleted = true
+	room.Timer.CompletedAt = time.Now()
+
+	limits := RoomLimits{CompletedTimeout: time.Minute}
+	if reason := room.expiryReason(limits, time.Now()); reason != "" {
+		t.Fatalf("room expired too early: %s", reason)
+	}
+	if reason := room.expiryReason(limits, time.Now().Add(2*time.Minute)); reason == "" {
+		t.Fatal("expected completed room to expire")
+	}
+}
+
+func TestDeliverToClosedRoom(t *testing.T) {
+	room := newTestRoom(newTestHiker("1"))
+	for i := 0; i < cap(room.IncomingMsgs); i++ {
+		room.IncomingMsgs <- &ClientPacket{}
+	}
+
+	// A sender waiting on the full queue is let go when the room closes
+	delivered := make(chan bool)
+	go func() {
+		delivered <- room.deliver(&ClientPacket{Header: Header{Protocol: "pause"}})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	room.close()
+	select {
+	case ok := <-delivered:
+		if ok {
+			t.Fatal("expected delivery to a closed room to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sender still blocked after the room closed")
+	}
+
+	if room.deliver(&ClientPacket{}) {
+		t.Fatal("expected delivery to a closed room to fail")
+	}
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLobbyPageSize = 20
+	maxLobbyPageSize     = 100
+)
+
+// RoomSummary is the public listing of a room shown in the lobby.
+type RoomSummary struct {
+	Id            string   `json:"id"`
+	Name          string   `json:"name"`
+	Topic         string   `json:"topic"`
+	Tags          []string `json:"tags"`
+	Hikers        int      `json:"hikers"`
+	Capacity      int      `json:"capacity"` // 0 when unlimited
+	Phase         string   `json:"phase"`
+	RemainingTime float64  `json:"remainingTime"`     // Seconds left in the current phase
+	Elapsed       float64  `json:"elapsed,omitempty"` // Seconds flowtime focus has run, it has no time left
+
+	ScheduledStart *time.Time `json:"scheduledStart"`
+}
+
+// LobbyFilter selects and pages public rooms for listRooms and GET /rooms.
+type LobbyFilter struct {
+	Tag      string `json:"tag"`
+	Query    string `json:"query"` // Matched against name and topic
+	Phase    string `json:"phase"`
+	HasSpace bool   `json:"hasSpace"`
+	Page     int    `json:"page"` // 1 based
+	PageSize int    `json:"pageSize"`
+}
+
+// Lobby tracks clients subscribed to live public room updates.
+type Lobby struct {
+	mux         sync.RWMutex
+	subscribers map[*Client]bool
+}
+
+func newLobby() *Lobby {
+	return &Lobby{subscribers: make(map[*Client]bool)}
+}
+
+func (l *Lobby) subscribe(c *Client) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.subscribers[c] = true
+}
+
+func (l *Lobby) unsubscribe(c *Client) {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	delete(l.subscribers, c)
+}
+
+// publish sends a lobby event ("opened", "updated" or "closed") to every subscriber.
+func (l *Lobby) publish(event string, summary RoomSummary) {
+	if l == nil {
+		return
+	}
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	for c := range l.subscribers {
+		packet := ServerPacket{
+			Header: Header{Protocol: "lobby", UserId: c.Id},
+			Response: map[string]interface{}{
+				"type":  "broadcast",
+				"event": event,
+				"room":  summary,
+			},
+		}
+		select {
+		case c.MsgCh <- packet:
+		default:
+			fmt.Printf("Lobby update dropped for %v\n", c.Username)
+		}
+	}
+}
+
+// phase describes what the room's timer is doing for the lobby.
+func (r *Room) phase() string {
+	r.Timer.TimerMux.RLock()
+	defer r.Timer.TimerMux.RUnlock()
+	if r.Timer.IsPaused {
+		return "paused"
+	}
+	return string(r.Timer.currentPhase())
+}
+
+func (r *Room) summary() RoomSummary {
+	r.ConfigMux.RLock()
+	summary := RoomSummary{
+		Id:    r.Id,
+		Name:  r.Config.Name,
+		Topic: r.Config.Topic,
+		Tags:  r.Config.Tags,
+
+		ScheduledStart: r.Config.ScheduledStart,
+	}
+	r.ConfigMux.RUnlock()
+
+	r.HikersMux.RLock()
+	summary.Hikers = len(r.Hikers)
+	r.HikersMux.RUnlock()
+	summary.Capacity = r.capacity()
+	summary.Phase = r.phase()
+	if summary.Phase != "idle" {
+		phaseTime := r.Timer.addPhaseTime(map[string]interface{}{})
+		summary.RemainingTime, _ = phaseTime["remainingTime"].(float64)
+		summary.Elapsed, _ = phaseTime["elapsed"].(float64)
+	}
+	return summary
+}
+
+func (r *Room) isPublic() bool {
+	r.ConfigMux.RLock()
+	defer r.ConfigMux.RUnlock()
+	return r.Config.Public
+}
+
+// publishLobby tells lobby subscribers about changes to the room's listing.
+// Nothing is sent when the listing is unchanged, ignoring remaining time.
+func (r *Room) publishLobby() {
+	if r.lobby == nil {
+		return
+	}
+	public := r.isPublic()
+	summary := r.summary()
+
+	r.lobbyMux.Lock()
+	defer r.lobbyMux.Unlock()
+	if r.closed {
+		return
+	}
+	switch {
+	case public && r.lobbyListed == nil:
+		r.lobby.publish("opened", summary)
+	case public && !sameListing(*r.lobbyListed, summary):
+		r.lobby.publish("updated", summary)
+	case !public && r.lobbyListed != nil:
+		r.lobby.publish("closed", *r.lobbyListed)
+		r.lobbyListed = nil
+		return
+	default:
+		return
+	}
+	r.lobbyListed = &summary
+}
+
+// publishLobbyClosed removes the room from the lobby once it closes.
+func (r *Room) publishLobbyClosed() {
+	r.lobbyMux.Lock()
+	defer r.lobbyMux.Unlock()
+	if r.lobbyListed != nil {
+		r.lobby.publish("closed", *r.lobbyListed)
+		r.lobbyListed = nil
+	}
+}
+
+func sameListing(a RoomSummary, b RoomSummary) bool {
+	return a.Name == b.Name && a.Topic == b.Topic && strings.Join(a.Tags, ",") == strings.Join(b.Tags, ",") &&
+		a.Hikers == b.Hikers && a.Capacity == b.Capacity && a.Phase == b.Phase &&
+		(a.ScheduledStart == nil) == (b.ScheduledStart == nil) &&
+		(a.ScheduledStart == nil || a.ScheduledStart.Equal(*b.ScheduledStart))
+}
+
+// listRooms returns one page of public rooms matching filter and the total match count.
+func (s *Server) listRooms(filter LobbyFilter) ([]RoomSummary, int) {
+	s.mux.RLock()
+	rooms := make([]*Room, 0, len(s.Rooms))
+	for _, room := range s.Rooms {
+		rooms = append(rooms, room)
+	}
+	s.mux.RUnlock()
+
+	query := strings.ToLower(filter.Query)
+	tag := strings.ToLower(filter.Tag)
+	matches := []RoomSummary{}
+	for _, room := range rooms {
+		if !room.isPublic() {
+			continue
+		}
+		summary := room.summary()
+		if tag != "" && !containsString(summary.Tags, tag) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(summary.Name), query) && !strings.Contains(strings.ToLower(summary.Topic), query) {
+			continue
+		}
+		if filter.Phase != "" && summary.Phase != filter.Phase {
+			continue
+		}
+		if filter.HasSpace && summary.Capacity > 0 && summary.Hikers >= summary.Capacity {
+			continue
+		}
+		matches = append(matches, summary)
+	}
+	// Busiest rooms first, then by name for a stable order between pages
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Hikers != matches[j].Hikers {
+			return matches[i].Hikers > matches[j].Hikers
+		}
+		if matches[i].Name != matches[j].Name {
+			return matches[i].Name < matches[j].Name
+		}
+		return matches[i].Id < matches[j].Id
+	})
+
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultLobbyPageSize
+	}
+	if pageSize > maxLobbyPageSize {
+		pageSize = maxLobbyPageSize
+	}
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * pageSize
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + pageSize
+	if end > len(matches) {
+		end = len(matches)
+	}
+	return matches[start:end], len(matches)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// listRooms_protocol replies to c with a page of public rooms.
+func (s *Server) listRooms_protocol(c *Client, message map[string]interface{}) error {
+	filter := LobbyFilter{}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error in listRooms_protocol: %v", err)
+	}
+	if err := json.Unmarshal(data, &filter); err != nil {
+		s.sendError(c, "Invalid room filter")
+		return fmt.Errorf("error in listRooms_protocol: %v", err)
+	}
+
+	rooms, total := s.listRooms(filter)
+	packet := ServerPacket{
+		Header: Header{Protocol: "listRooms", UserId: c.Id},
+		Response: map[string]interface{}{
+			"type":   "direct",
+			"status": "success",
+			"rooms":  rooms,
+			"total":  total,
+		},
+	}
+	select {
+	case c.MsgCh <- packet:
+	default:
+		s.removeClient(c)
+	}
+	return nil
+}
+
+// handleRooms serves the public room list over HTTP with the same filters as listRooms.
+func (s *Server) handleRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	filter := LobbyFilter{
+		Tag:      query.Get("tag"),
+		Query:    query.Get("query"),
+		Phase:    query.Get("phase"),
+		HasSpace: query.Get("hasSpace") == "true",
+	}
+	filter.Page, _ = strconv.Atoi(query.Get("page"))
+	filter.PageSize, _ = strconv.Atoi(query.Get("pageSize"))
+
+	rooms, total := s.listRooms(filter)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rooms": rooms,
+		"total": total,
+	})
+}
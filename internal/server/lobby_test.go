@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestListRoomsFiltersAndPages(t *testing.T) {
+	s := NewServer("", 0)
+	for i := 0; i < 5; i++ {
+		room := newTestRoom(newTestHiker("host"))
+		room.Id = fmt.Sprintf("room%d", i)
+		tags := []interface{}{"math"}
+		if i%2 == 1 {
+			tags = []interface{}{"Writing"}
+		}
+		err := room.applyRoomConfig(map[string]interface{}{
+			"public": i != 4, // room4 stays private
+			"name":   fmt.Sprintf("Study %d", i),
+			"tags":   tags,
+		})
+		if err != nil {
+			t.Fatalf("applyRoomConfig failed: %v", err)
+		}
+		s.Rooms[room.Id] = room
+	}
+
+	rooms, total := s.listRooms(LobbyFilter{})
+	if total != 4 || len(rooms) != 4 {
+		t.Fatalf("expected 4 public rooms, got %d (%d on page)", total, len(rooms))
+	}
+
+	rooms, total = s.listRooms(LobbyFilter{Tag: "writing"})
+	if total != 2 {
+		t.Fatalf("expected 2 writing rooms, got %d", total)
+	}
+
+	rooms, total = s.listRooms(LobbyFilter{Page: 2, PageSize: 3})
+	if total != 4 || len(rooms) != 1 || rooms[0].Name != "Study 3" {
+		t.Fatalf("unexpected second page: total %d rooms %+v", total, rooms)
+	}
+}
+
+func TestLobbySubscribersSeeRoomChanges(t *testing.T) {
+	lobby := newLobby()
+	subscriber := newTestHiker("watcher")
+	lobby.subscribe(subscriber)
+
+	host := newTestHiker("1")
+	room := newTestRoom(host)
+	room.lobby = lobby
+
+	// Private rooms stay out of the lobby
+	room.publishLobby()
+	if len(subscriber.MsgCh) != 0 {
+		t.Fatal("private room was published")
+	}
+
+	if err := room.applyRoomConfig(map[string]interface{}{"public": true, "name": "Morning Hike"}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+	room.publishLobby()
+	if packet := lastPacket(t, subscriber); packet.Response["event"] != "opened" {
+		t.Fatalf("expected opened event, got %v", packet.Response["event"])
+	}
+
+	// Unchanged listing sends nothing
+	room.publishLobby()
+	if len(subscriber.MsgCh) != 0 {
+		t.Fatal("unchanged room was published again")
+	}
+
+	if err := room.join_protocol(newTestHiker("2")); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	room.publishLobby()
+	packet := lastPacket(t, subscriber)
+	if packet.Response["event"] != "updated" || packet.Response["room"].(RoomSummary).Hikers != 2 {
+		t.Fatalf("expected updated event with 2 hikers, got %+v", packet.Response)
+	}
+
+	room.close()
+	if packet := lastPacket(t, subscriber); packet.Response["event"] != "closed" {
+		t.Fatalf("expected closed event, got %v", packet.Response["event"])
+	}
+}
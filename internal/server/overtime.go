@@ -0,0 +1,93 @@
+package server
+
+import "fmt"
+
+// DefaultOvertimeRate is the fraction of the pace hikers in overtime cover
+// when the room doesn't set overtimeRate.
+const DefaultOvertimeRate = 0.5
+
+const maxOvertimeRate = 3
+
+// validateOvertime checks the OvertimeRate of a TimerConfig.
+func (c TimerConfig) validateOvertime() error {
+	if c.OvertimeRate < 0 || c.OvertimeRate > maxOvertimeRate {
+		return fmt.Errorf("overtimeRate must be between 0 and %d", maxOvertimeRate)
+	}
+	return nil
+}
+
+// overtimeRate is OvertimeRate, or DefaultOvertimeRate when unset. The caller
+// must hold TimerMux.
+func (t *Timer) overtimeRate() float64 {
+	if t.OvertimeRate > 0 {
+		return float64(t.OvertimeRate)
+	}
+	return DefaultOvertimeRate
+}
+
+// overtime_protocol opts h in or out of overtime: hiking on through the
+// current or next break at overtimeRate times the pace. The distance is
+// counted apart as OvertimeDistance, and h rejoins the room at the next
+// focus block.
+func (r *Room) overtime_protocol(h *Client, enabled bool) error {
+	r.Timer.TimerMux.RLock()
+	phase := r.Timer.currentPhase()
+	r.Timer.TimerMux.RUnlock()
+	if phase != PhaseFocus && !phase.isBreak() {
+		r.sendError(h, "Overtime is only available during a session")
+		return fmt.Errorf("error in overtime_protocol: room %s is in %s", r.Id, phase)
+	}
+
+	// Settle the distance covered so far at the old setting
+	r.accrueMux.Lock()
+	r.accrueLocked()
+	r.HikersMux.Lock()
+	changed := h.Overtime != enabled
+	h.Overtime = enabled
+	r.HikersMux.Unlock()
+	r.accrueMux.Unlock()
+	if !changed {
+		return nil
+	}
+	if enabled {
+		// Updates stop for a break resumed without anyone in overtime
+		r.Timer.TimerMux.Lock()
+		if r.Timer.currentPhase().isBreak() && !r.Timer.IsPaused && r.Timer.quit == nil {
+			r.Timer.startUpdates(r)
+		}
+		r.Timer.TimerMux.Unlock()
+	}
+
+	message := fmt.Sprintf("%s is going into overtime", h.Username)
+	if !enabled {
+		message = fmt.Sprintf("%s left overtime", h.Username)
+	}
+	r.audit(h, "overtime", map[string]interface{}{"enabled": enabled})
+	return r.broadcast("overtime", map[string]interface{}{
+		"type":    "broadcast",
+		"userId":  h.Id,
+		"enabled": enabled,
+		"message": message,
+	})
+}
+
+// anyOvertime reports whether a hiker is in overtime.
+func (r *Room) anyOvertime() bool {
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	for _, hiker := range r.Hikers {
+		if hiker.Overtime {
+			return true
+		}
+	}
+	return false
+}
+
+// endOvertime brings every hiker in overtime back to the room's schedule.
+func (r *Room) endOvertime() {
+	r.HikersMux.Lock()
+	defer r.HikersMux.Unlock()
+	for _, hiker := range r.Hikers {
+		hiker.Overtime = false
+	}
+}
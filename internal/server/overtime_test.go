@@ -0,0 +1,93 @@
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOvertimeAccruesThroughTheBreak(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, hiker)
+	room.Timer.FocusTime = 3600
+	room.Timer.ShortBreakTime = 1800
+
+	err := room.updateConfig_protocol(host, "", map[string]interface{}{"overtimeRate": 1.5}, nil, nil)
+	if err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if err := room.overtime_protocol(hiker, true); err == nil {
+		t.Fatal("expected overtime before the start to fail")
+	}
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(30 * time.Minute)
+	if err := room.overtime_protocol(hiker, true); err != nil {
+		t.Fatalf("overtime failed: %v", err)
+	}
+	waitForProtocol(t, host, "overtime")
+
+	// Through the rest of focus and the whole break
+	clock.Advance(time.Hour)
+	if room.Timer.Phase != PhaseFocus || hiker.Overtime {
+		t.Fatalf("expected the hiker back on schedule for focus, got %s", room.Timer.Phase)
+	}
+	if math.Abs(host.Distance-2) > 1e-9 || math.Abs(hiker.Distance-2) > 1e-9 {
+		t.Fatalf("expected 2 miles each, got %f and %f", host.Distance, hiker.Distance)
+	}
+	// 30 minutes at 2 mph times 1.5
+	if math.Abs(hiker.OvertimeDistance-1.5) > 1e-9 || host.OvertimeDistance != 0 {
+		t.Fatalf("expected 1.5 and 0 overtime miles, got %f and %f", hiker.OvertimeDistance, host.OvertimeDistance)
+	}
+	if math.Abs(room.Session.OvertimeDistance-1.5) > 1e-9 || math.Abs(room.Session.Distance-4) > 1e-9 {
+		t.Fatalf("expected 4 miles and 1.5 overtime, got %f and %f", room.Session.Distance, room.Session.OvertimeDistance)
+	}
+}
+
+func TestOvertimeRateValidation(t *testing.T) {
+	if err := (TimerConfig{OvertimeRate: 4}).validateOvertime(); err == nil {
+		t.Fatal("expected an overtimeRate above the limit to fail")
+	}
+	if err := (TimerConfig{OvertimeRate: 0.25}).validateOvertime(); err != nil {
+		t.Fatalf("expected overtimeRate 0.25 to pass, got %v", err)
+	}
+}
+
+func TestOvertimeUpdatesAfterRoomResume(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, hiker)
+	room.Timer.applyConfig(TimerConfig{Pace: 2, Intervals: []Interval{
+		{Kind: PhaseFocus, Duration: 3600},
+		{Kind: PhaseShortBreak, Duration: 1800, Pace: 10},
+		{Kind: PhaseFocus, Duration: 60},
+	}})
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := room.overtime_protocol(hiker, true); err != nil {
+		t.Fatalf("overtime failed: %v", err)
+	}
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+	if err := room.resumeRoom_protocol(host); err != nil {
+		t.Fatalf("resumeRoom failed: %v", err)
+	}
+
+	// Hikers in overtime keep getting live updates through the break
+	lastPacket(t, hiker)
+	clock.Advance(time.Minute)
+	waitForProtocol(t, hiker, "update")
+
+	// 30 minutes at the focus pace of 2 mph, not the break's 10, times 0.5
+	clock.Advance(29 * time.Minute)
+	if room.Timer.Phase != PhaseFocus || math.Abs(hiker.OvertimeDistance-0.5) > 1e-9 {
+		t.Fatalf("expected 0.5 overtime miles by the next focus, got %f in %s", hiker.OvertimeDistance, room.Timer.Phase)
+	}
+}
@@ -0,0 +1,425 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// slugPattern is the allowed format for persistent room slugs.
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,39}$`)
+
+// TimerConfig is the saved, user-facing part of a Timer.
+type TimerConfig struct {
+	FocusTime      uint16  `json:"focusTime"`
+	ShortBreakTime uint16  `json:"shortBreakTime"`
+	LongBreakTime  uint16  `json:"longBreakTime"`
+	CountdownTime  uint16  `json:"countdownTime"` // Seconds before the first focus block
+	Sets           uint8   `json:"sets"`
+	Pace           float32 `json:"pace"`
+	UpdateEvery    uint16  `json:"updateEvery"` // Seconds between update broadcasts
+	AutoContinue   bool    `json:"autoContinue"`
+	Flowtime       bool    `json:"flowtime"`     // Open-ended focus ended by stopFocus
+	BreakRatio     float32 `json:"breakRatio"`   // Flowtime break length per second of focus
+	OvertimeRate   float32 `json:"overtimeRate"` // Pace multiplier for hikers in overtime
+	// LongBreakEvery gives a long break after every that many sets, 0 for
+	// short breaks only
+	LongBreakEvery uint8 `json:"longBreakEvery"`
+	// Cycles sets Sets to Cycles × LongBreakEvery when both are set
+	Cycles uint8 `json:"cycles"`
+	// EventDifficulty selects trail events: 0 none, 1 easy, 2 medium, 3 hard
+	EventDifficulty uint8 `json:"eventDifficulty"`
+	// Warnings are the seconds left in a phase at which the room is warned
+	Warnings []uint16 `json:"warnings"`
+	// Intervals is a custom schedule run instead of the times and sets above
+	Intervals []Interval `json:"intervals,omitempty"`
+}
+
+// SessionConfig is the saved, user-facing part of a Session.
+type SessionConfig struct {
+	Name string `json:"name"`
+}
+
+// PersistentRoom is the stored form of a durable room that outlives its hikers.
+type PersistentRoom struct {
+	Id             string            `json:"id"`
+	Slug           string            `json:"slug"`
+	Owner          string            `json:"owner"`
+	Members        map[string]string `json:"members"` // User id to last known username
+	DefaultTimer   TimerConfig       `json:"defaultTimer"`
+	DefaultSession SessionConfig     `json:"defaultSession"`
+	Config         RoomConfig        `json:"config"`
+}
+
+// RoomStore keeps persistent rooms in a local JSON file.
+type RoomStore struct {
+	mux   sync.Mutex
+	path  string
+	rooms map[string]PersistentRoom
+}
+
+// LoadRoomStore reads the persistent rooms stored at path. A missing file
+// yields an empty store.
+func LoadRoomStore(path string) (*RoomStore, error) {
+	store := &RoomStore{path: path, rooms: make(map[string]PersistentRoom)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LoadRoomStore error: %v", err)
+	}
+	var rooms []PersistentRoom
+	if err := json.Unmarshal(data, &rooms); err != nil {
+		return nil, fmt.Errorf("LoadRoomStore error: %v", err)
+	}
+	for _, room := range rooms {
+		store.rooms[room.Id] = room
+	}
+	return store, nil
+}
+
+func (rs *RoomStore) put(room PersistentRoom) error {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	rs.rooms[room.Id] = room
+	return rs.save()
+}
+
+func (rs *RoomStore) remove(id string) error {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	delete(rs.rooms, id)
+	return rs.save()
+}
+
+// all returns the stored rooms ordered by slug.
+func (rs *RoomStore) all() []PersistentRoom {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	rooms := make([]PersistentRoom, 0, len(rs.rooms))
+	for _, room := range rs.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Slug < rooms[j].Slug })
+	return rooms
+}
+
+// save writes the store to its file. The caller must hold mux.
+func (rs *RoomStore) save() error {
+	if rs.path == "" {
+		return nil
+	}
+	rooms := make([]PersistentRoom, 0, len(rs.rooms))
+	for _, room := range rs.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Slug < rooms[j].Slug })
+	data, err := json.MarshalIndent(rooms, "", "  ")
+	if err != nil {
+		return fmt.Errorf("RoomStore save error: %v", err)
+	}
+	tmp := rs.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("RoomStore save error: %v", err)
+	}
+	if err := os.Rename(tmp, rs.path); err != nil {
+		return fmt.Errorf("RoomStore save error: %v", err)
+	}
+	return nil
+}
+
+// config returns the timer's saved settings.
+func (t *Timer) config() TimerConfig {
+	t.TimerMux.RLock()
+	defer t.TimerMux.RUnlock()
+	return t.settings()
+}
+
+// settings is config for callers that already hold TimerMux.
+func (t *Timer) settings() TimerConfig {
+	return TimerConfig{
+		FocusTime:       t.FocusTime,
+		ShortBreakTime:  t.ShortBreakTime,
+		LongBreakTime:   t.LongBreakTime,
+		CountdownTime:   t.CountdownTime,
+		Warnings:        slices.Clone(t.Warnings),
+		Sets:            t.Sets,
+		Pace:            t.Pace,
+		UpdateEvery:     t.UpdateEvery,
+		AutoContinue:    t.AutoContinue,
+		Flowtime:        t.Flowtime,
+		BreakRatio:      t.BreakRatio,
+		OvertimeRate:    t.OvertimeRate,
+		LongBreakEvery:  t.LongBreakEvery,
+		Cycles:          t.Cycles,
+		EventDifficulty: t.EventDifficulty,
+		Intervals:       slices.Clone(t.Intervals),
+	}
+}
+
+// applyConfig overwrites the timer's settings with config.
+func (t *Timer) applyConfig(config TimerConfig) {
+	t.TimerMux.Lock()
+	defer t.TimerMux.Unlock()
+	t.setConfig(config)
+}
+
+// setConfig is applyConfig for callers that already hold TimerMux.
+func (t *Timer) setConfig(config TimerConfig) {
+	t.FocusTime = config.FocusTime
+	t.ShortBreakTime = config.ShortBreakTime
+	t.LongBreakTime = config.LongBreakTime
+	t.CountdownTime = config.CountdownTime
+	t.Warnings = slices.Clone(config.Warnings)
+	t.Sets = config.Sets
+	t.Pace = config.Pace
+	t.UpdateEvery = config.UpdateEvery
+	t.AutoContinue = config.AutoContinue
+	t.Flowtime = config.Flowtime
+	t.BreakRatio = config.BreakRatio
+	t.OvertimeRate = config.OvertimeRate
+	t.LongBreakEvery = config.LongBreakEvery
+	t.Cycles = config.Cycles
+	t.EventDifficulty = config.EventDifficulty
+	if config.Cycles > 0 && config.LongBreakEvery > 0 {
+		t.Sets = config.Cycles * config.LongBreakEvery
+	}
+	t.setIntervals(config.Intervals)
+}
+
+// validate checks settings a client sent with updateConfig.
+func (c TimerConfig) validate() error {
+	if c.Cycles > 0 && c.LongBreakEvery > 0 && int(c.Cycles)*int(c.LongBreakEvery) > math.MaxUint8 {
+		return fmt.Errorf("cycles × longBreakEvery must be at most %d sets", math.MaxUint8)
+	}
+	if err := c.validateWarnings(); err != nil {
+		return err
+	}
+	if err := c.validateFlowtime(); err != nil {
+		return err
+	}
+	if err := c.validateOvertime(); err != nil {
+		return err
+	}
+	if len(c.Intervals) > maxIntervals {
+		return fmt.Errorf("a schedule can have at most %d intervals", maxIntervals)
+	}
+	if focusCount(c.Intervals) > math.MaxUint8 {
+		return fmt.Errorf("a schedule can have at most %d focus intervals", math.MaxUint8)
+	}
+	return validateIntervals(c.Intervals, PhaseIdle)
+}
+
+// makePersistent turns a new room into a durable room reachable by slug and
+// registers it with the server. The slug is checked and claimed under one
+// lock so two creates can't both take it.
+func (s *Server) makePersistent(r *Room, slug string, owner string) error {
+	if s.RoomStore == nil {
+		return fmt.Errorf("Persistent rooms are not enabled on this server")
+	}
+	if !slugPattern.MatchString(slug) {
+		return fmt.Errorf("Slug must be 3-40 lowercase letters, numbers or dashes")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.findRoomLocked(slug); ok {
+		return fmt.Errorf("Slug %s is already taken", slug)
+	}
+	r.Persistent = true
+	r.Slug = slug
+	r.Owner = owner
+	r.Members = make(map[string]string)
+	r.store = s.RoomStore
+	s.Rooms[r.Id] = r
+	return nil
+}
+
+// findRoom looks a room up by id, falling back to a persistent room's slug.
+func (s *Server) findRoom(idOrSlug string) (*Room, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.findRoomLocked(idOrSlug)
+}
+
+// findRoomLocked is findRoom for callers already holding s.mux.
+func (s *Server) findRoomLocked(idOrSlug string) (*Room, bool) {
+	if room, ok := s.Rooms[idOrSlug]; ok && !room.isClosed() {
+		return room, true
+	}
+	for _, room := range s.Rooms {
+		if room.Persistent && room.Slug == idOrSlug && !room.isClosed() {
+			return room, true
+		}
+	}
+	return nil, false
+}
+
+// restoreRooms registers every stored persistent room, empty and idle.
+func (s *Server) restoreRooms() {
+	if s.RoomStore == nil {
+		return
+	}
+	for _, stored := range s.RoomStore.all() {
+		room := s.newRoom(stored.Id)
+		room.Persistent = true
+		room.Slug = stored.Slug
+		room.Owner = stored.Owner
+		room.Members = stored.Members
+		if room.Members == nil {
+			room.Members = make(map[string]string)
+		}
+		room.DefaultTimer = stored.DefaultTimer
+		room.DefaultSession = stored.DefaultSession
+		room.Config = stored.Config
+		room.store = s.RoomStore
+		room.Host = ""
+		room.resetForNextSession()
+		if at := room.scheduledStart(); at != nil && !at.After(room.clock().Now()) {
+			// Missed while the server was down
+			room.Config.ScheduledStart = nil
+		}
+		room.syncSchedule()
+
+		s.mux.Lock()
+		s.Rooms[room.Id] = room
+		s.mux.Unlock()
+		go room.handleRoomMessages()
+		fmt.Printf("Restored persistent room %s (%s)\n", room.Slug, room.Id)
+	}
+}
+
+// record captures the room's durable state.
+func (r *Room) record() PersistentRoom {
+	r.HikersMux.RLock()
+	members := make(map[string]string, len(r.Members))
+	for id, username := range r.Members {
+		members[id] = username
+	}
+	r.HikersMux.RUnlock()
+
+	r.ConfigMux.RLock()
+	config := r.Config
+	r.ConfigMux.RUnlock()
+
+	return PersistentRoom{
+		Id:             r.Id,
+		Slug:           r.Slug,
+		Owner:          r.Owner,
+		Members:        members,
+		DefaultTimer:   r.DefaultTimer,
+		DefaultSession: r.DefaultSession,
+		Config:         config,
+	}
+}
+
+// persist writes a persistent room to its store.
+func (r *Room) persist() {
+	if !r.Persistent || r.store == nil {
+		return
+	}
+	if err := r.store.put(r.record()); err != nil {
+		fmt.Printf("Error persisting room %s: %v\n", r.Id, err)
+	}
+}
+
+// addMember remembers h as a member of a persistent room.
+func (r *Room) addMember(h *Client) {
+	if !r.Persistent {
+		return
+	}
+	r.HikersMux.Lock()
+	changed := r.Members[h.Id] != h.Username
+	r.Members[h.Id] = h.Username
+	r.HikersMux.Unlock()
+	if changed {
+		r.persist()
+	}
+}
+
+// captureDefaults saves the room's current timer and session settings as the
+// defaults restored between sessions.
+func (r *Room) captureDefaults() {
+	r.DefaultTimer = r.Timer.config()
+	r.Session.SessionMux.RLock()
+	r.DefaultSession = SessionConfig{Name: r.Session.Name}
+	r.Session.SessionMux.RUnlock()
+}
+
+// resetForNextSession stops the timer and restores the saved defaults once a
+// persistent room is empty, so the next group starts clean.
+func (r *Room) resetForNextSession() {
+	r.Timer.Stop()
+	r.cancelHostGrace()
+	r.cancelDecision()
+
+	r.Timer.TimerMux.Lock()
+	r.Timer.CompletedSets = 0
+	r.Timer.StartTime = ""
+	r.Timer.TimerMux.Unlock()
+	r.Timer.applyConfig(r.DefaultTimer)
+
+	r.Session.Reset()
+	r.Session.SessionMux.Lock()
+	r.Session.Level = 1
+	r.Session.Name = r.DefaultSession.Name
+	r.Session.SessionMux.Unlock()
+
+	r.HikersMux.Lock()
+	r.Host = ""
+	r.HikersMux.Unlock()
+}
+
+// saveDefaults_protocol lets the owner or host store the current settings as
+// the persistent room's defaults.
+func (r *Room) saveDefaults_protocol(h *Client) error {
+	if !r.Persistent {
+		r.sendError(h, "Only persistent rooms have saved defaults")
+		return fmt.Errorf("error in saveDefaults_protocol: room %s is not persistent", r.Id)
+	}
+	if h.Id != r.Owner && !r.isHost(h) {
+		r.sendError(h, "Only the owner or host can save defaults")
+		return fmt.Errorf("error in saveDefaults_protocol: %s is not the owner or host", h.Id)
+	}
+	r.captureDefaults()
+	r.persist()
+	r.audit(h, "saveDefaults", map[string]interface{}{
+		"timer":   r.DefaultTimer,
+		"session": r.DefaultSession,
+	})
+
+	packet, err := r.packMessage("saveDefaults", map[string]interface{}{
+		"type":           "direct",
+		"status":         "success",
+		"message":        "Defaults saved",
+		"defaultTimer":   r.DefaultTimer,
+		"defaultSession": r.DefaultSession,
+	}, h)
+	if err != nil {
+		return fmt.Errorf("error in saveDefaults_protocol: %v", err)
+	}
+	r.sendMessage(h, packet)
+	return nil
+}
+
+// deleteRoom_protocol lets the owner remove a persistent room for good.
+func (r *Room) deleteRoom_protocol(h *Client) error {
+	if !r.Persistent || h.Id != r.Owner {
+		r.sendError(h, "Only the owner can delete this room")
+		return fmt.Errorf("error in deleteRoom_protocol: %s is not the owner", h.Id)
+	}
+	if r.store != nil {
+		if err := r.store.remove(r.Id); err != nil {
+			return fmt.Errorf("error in deleteRoom_protocol: %v", err)
+		}
+	}
+	r.audit(h, "deleteRoom", map[string]interface{}{"slug": r.Slug})
+	r.expire("The owner deleted this room")
+	return nil
+}
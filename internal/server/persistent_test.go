@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestPersistentRoomSurvivesEmptyAndRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rooms.json")
+	store, err := LoadRoomStore(path)
+	if err != nil {
+		t.Fatalf("LoadRoomStore failed: %v", err)
+	}
+	s := NewServer("", 0)
+	s.RoomStore = store
+
+	owner := newTestHiker("1")
+	room := s.newRoom("room1")
+	if err := s.makePersistent(room, "Bad Slug!", owner.Id); err == nil {
+		t.Fatal("expected invalid slug to be rejected")
+	}
+	if err := s.makePersistent(room, "weekday-study", owner.Id); err != nil {
+		t.Fatalf("makePersistent failed: %v", err)
+	}
+	if s.Rooms[room.Id] != room {
+		t.Fatal("expected makePersistent to register the room")
+	}
+	room.Host = owner.Id
+	room.Timer.FocusTime = 3000
+	if err := room.create_protocol(owner, nil); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	// Config drifts during a session, then everyone leaves
+	room.Timer.FocusTime = 60
+	room.Timer.CompletedSets = 2
+	if got := room.RemoveHiker(owner); got != "room emptied" {
+		t.Fatalf("expected room to be emptied, got %q", got)
+	}
+	if room.isClosed() || room.Timer.FocusTime != 3000 || room.Timer.CompletedSets != 0 || room.Host != "" {
+		t.Fatalf("room not reset for the next session: %+v", room.Timer.config())
+	}
+
+	found, ok := s.findRoom("weekday-study")
+	if !ok || found != room {
+		t.Fatal("persistent room not found by slug")
+	}
+	member := newTestHiker("2")
+	if err := found.join_protocol(member); err != nil {
+		t.Fatalf("join by slug failed: %v", err)
+	}
+	if room.Host != member.Id {
+		t.Fatalf("expected first hiker back to be host, got %q", room.Host)
+	}
+
+	// A new server picks the room back up from disk
+	reloaded, err := LoadRoomStore(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	restarted := NewServer("", 0)
+	restarted.RoomStore = reloaded
+	restarted.restoreRooms()
+	restored, ok := restarted.findRoom("weekday-study")
+	if !ok {
+		t.Fatal("persistent room not restored")
+	}
+	if restored.Owner != owner.Id || restored.Timer.FocusTime != 3000 || len(restored.Members) != 2 {
+		t.Fatalf("restored room lost state: owner %s focus %d members %v", restored.Owner, restored.Timer.FocusTime, restored.Members)
+	}
+	restored.close()
+}
+
+func TestConcurrentCreatesClaimSlugOnce(t *testing.T) {
+	store, err := LoadRoomStore(filepath.Join(t.TempDir(), "rooms.json"))
+	if err != nil {
+		t.Fatalf("LoadRoomStore failed: %v", err)
+	}
+	s := NewServer("", 0)
+	s.RoomStore = store
+
+	const creates = 16
+	var wg sync.WaitGroup
+	var claimedMux sync.Mutex
+	claimed := 0
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			room := s.newRoom(fmt.Sprintf("room%d", i))
+			if err := s.makePersistent(room, "weekday-study", "1"); err == nil {
+				claimedMux.Lock()
+				claimed++
+				claimedMux.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if claimed != 1 || len(s.Rooms) != 1 {
+		t.Fatalf("expected one room to claim the slug, got %d claims and %d rooms", claimed, len(s.Rooms))
+	}
+	for _, room := range s.Rooms {
+		room.close()
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// Phase is where a room's timer is in its session.
+type Phase string
+
+const (
+	PhaseIdle             Phase = "idle"             // Not started
+	PhaseCountdown        Phase = "countdown"        // Counting down to the first focus block
+	PhaseFocus            Phase = "focus"            // Hikers accrue distance
+	PhaseShortBreak       Phase = "shortBreak"       // Between sets
+	PhaseLongBreak        Phase = "longBreak"        // Before extra sets
+	PhaseAwaitingDecision Phase = "awaitingDecision" // Every set is done, waiting on the end modal
+	PhaseCompleted        Phase = "completed"        // Ended by the host
+)
+
+// phaseTransitions lists the phases each phase may move to. Any phase may
+// return to PhaseIdle when the timer is reset.
+var phaseTransitions = map[Phase][]Phase{
+	PhaseIdle:             {PhaseCountdown, PhaseFocus},
+	PhaseCountdown:        {PhaseFocus, PhaseCompleted},
+	PhaseFocus:            {PhaseShortBreak, PhaseLongBreak, PhaseAwaitingDecision, PhaseCompleted},
+	PhaseShortBreak:       {PhaseFocus, PhaseAwaitingDecision, PhaseCompleted},
+	PhaseLongBreak:        {PhaseFocus, PhaseAwaitingDecision, PhaseCompleted},
+	PhaseAwaitingDecision: {PhaseFocus, PhaseLongBreak, PhaseCompleted},
+	PhaseCompleted:        {PhaseCountdown, PhaseFocus},
+}
+
+// canTransition reports whether the timer may move from one phase to another.
+func canTransition(from Phase, to Phase) bool {
+	if to == PhaseIdle {
+		return true
+	}
+	for _, next := range phaseTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// currentPhase returns the timer's phase, PhaseIdle for a new timer. The
+// caller must hold TimerMux.
+func (t *Timer) currentPhase() Phase {
+	if t.Phase == "" {
+		return PhaseIdle
+	}
+	return t.Phase
+}
+
+// isBreak reports whether p is one of the break phases.
+func (p Phase) isBreak() bool {
+	return p == PhaseShortBreak || p == PhaseLongBreak
+}
+
+// phaseLength is how long the timer stays in p, 0 for phases that wait. The
+// current custom interval sets its own length, and flowtime breaks follow the
+// focus block before them, see flowBreak.
+func (t *Timer) phaseLength(p Phase) uint16 {
+	if iv, ok := t.currentInterval(); ok && iv.Kind == p {
+		return iv.Duration
+	}
+	if t.Flowtime && p == PhaseFocus {
+		// Runs until stopFocus
+		return 0
+	}
+	if t.Flowtime && p.isBreak() {
+		return t.flowBreak(p)
+	}
+	switch p {
+	case PhaseCountdown:
+		return t.CountdownTime
+	case PhaseFocus:
+		return t.FocusTime
+	case PhaseShortBreak:
+		return t.ShortBreakTime
+	case PhaseLongBreak:
+		return t.LongBreakTime
+	}
+	return 0
+}
+
+// PhaseStep is one phase of a session's planned schedule.
+type PhaseStep struct {
+	Phase    Phase   `json:"phase"`
+	Duration float64 `json:"duration"` // Seconds
+	Set      int     `json:"set"`      // The set a focus block, or the break after it, belongs to
+	Label    string  `json:"label,omitempty"`
+	Pace     float32 `json:"pace,omitempty"`
+}
+
+// breakAfter picks what follows the completed'th set: a long break at the end
+// of each LongBreakEvery cycle, a short break otherwise, and the end modal
+// after the last set. With AutoContinue the last set gets a long break and the
+// cycles start over. The caller must hold TimerMux.
+func (t *Timer) breakAfter(completed uint8) Phase {
+	if t.Sets == 0 {
+		return PhaseAwaitingDecision
+	}
+	set := completed
+	if t.AutoContinue {
+		// Position within the current round of sets
+		set = (completed-1)%t.Sets + 1
+	}
+	switch {
+	case set >= t.Sets && t.AutoContinue:
+		return PhaseLongBreak
+	case set >= t.Sets:
+		return PhaseAwaitingDecision
+	case t.LongBreakEvery > 0 && set%t.LongBreakEvery == 0:
+		return PhaseLongBreak
+	default:
+		return PhaseShortBreak
+	}
+}
+
+// plannedSchedule lists one round of the session's phases, from the first
+// focus block to the end modal, or to the long break before the next round
+// with AutoContinue. A custom schedule lists its intervals. The caller must
+// hold TimerMux.
+func (t *Timer) plannedSchedule() []PhaseStep {
+	if len(t.Intervals) > 0 {
+		return t.intervalSchedule()
+	}
+	steps := make([]PhaseStep, 0, 2*int(t.Sets))
+	for set := 1; set <= int(t.Sets); set++ {
+		steps = append(steps, PhaseStep{Phase: PhaseFocus, Duration: toDuration(t.FocusTime).Seconds(), Set: set})
+		next := t.breakAfter(uint8(set))
+		if next == PhaseAwaitingDecision {
+			break
+		}
+		steps = append(steps, PhaseStep{Phase: next, Duration: toDuration(t.phaseLength(next)).Seconds(), Set: set})
+	}
+	return steps
+}
+
+// intervalSchedule is plannedSchedule for a custom schedule.
+func (t *Timer) intervalSchedule() []PhaseStep {
+	steps := make([]PhaseStep, 0, len(t.Intervals)+1)
+	set := 0
+	for _, iv := range t.Intervals {
+		if iv.Kind == PhaseFocus {
+			set++
+		}
+		steps = append(steps, PhaseStep{Phase: iv.Kind, Duration: toDuration(iv.Duration).Seconds(), Set: set, Label: iv.Label, Pace: iv.Pace})
+	}
+	if t.AutoContinue && t.Intervals[len(t.Intervals)-1].Kind == PhaseFocus {
+		steps = append(steps, PhaseStep{Phase: PhaseLongBreak, Duration: toDuration(t.LongBreakTime).Seconds(), Set: set})
+	}
+	return steps
+}
+
+// transition moves the timer to phase to, restarting the phase clock, and
+// returns the phase it left. Illegal transitions leave the timer untouched.
+// The caller must hold TimerMux and broadcast the change with phaseChanged
+// once it has unlocked.
+func (t *Timer) transition(to Phase) (Phase, error) {
+	from := t.currentPhase()
+	if !canTransition(from, to) {
+		return from, fmt.Errorf("cannot go from %s to %s", from, to)
+	}
+	if t.IsPaused && to != PhaseIdle && to != PhaseCompleted {
+		return from, fmt.Errorf("the room is paused")
+	}
+	now := t.clock().Now()
+	if to == PhaseIdle || to == PhaseCompleted {
+		// Ending or resetting a paused room unpauses it
+		t.IsPaused = false
+		t.PausedAt = time.Time{}
+	}
+	t.Phase = to
+	t.StartTimestamp = now
+	t.Duration = toDuration(t.phaseLength(to))
+	t.Adjusted = 0
+	t.accruedAt = now
+
+	// The flags mirror the phase for clients that read them
+	t.IsRunning = to != PhaseIdle && to != PhaseCompleted
+	t.IsBreak = to.isBreak()
+	t.IsCompleted = to == PhaseAwaitingDecision
+	if t.IsCompleted {
+		t.CompletedAt = now
+	}
+	if to == PhaseIdle || to == PhaseCompleted || to == PhaseAwaitingDecision {
+		if t.CountdownTimer != nil {
+			t.CountdownTimer.Stop()
+		}
+		t.stopWarnings()
+		t.phaseEnd = nil
+	}
+	return from, nil
+}
+
+// phaseChanged tells the room the timer moved from one phase to another.
+func (r *Room) phaseChanged(from Phase, to Phase) {
+	r.broadcast("phaseChanged", r.Timer.addPhaseTime(map[string]interface{}{
+		"type":  "broadcast",
+		"from":  from,
+		"to":    to,
+		"timer": r.Timer,
+	}))
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPhaseTransitionsAreValidated(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.Timer.Sets = 1
+
+	if err := room.end_protocol(host); err == nil {
+		t.Fatal("expected end to fail before the session starts")
+	}
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	changed := waitForProtocol(t, host, "phaseChanged")
+	if changed.Response["from"] != PhaseIdle || changed.Response["to"] != PhaseFocus {
+		t.Fatalf("unexpected phaseChanged %v", changed.Response)
+	}
+	if err := room.start_protocol(host); err == nil {
+		t.Fatal("expected a second start to fail")
+	}
+	if err := room.skipBreak_protocol(host); err == nil {
+		t.Fatal("expected skipBreak during focus to fail")
+	}
+	if err := room.extraSet_protocol(host); err == nil {
+		t.Fatal("expected extraSet before the last set to fail")
+	}
+
+	clock.Advance(1500 * time.Second)
+	if room.Timer.Phase != PhaseAwaitingDecision || !room.Timer.IsCompleted {
+		t.Fatalf("expected to await a decision, got %s", room.Timer.Phase)
+	}
+	if err := room.extraSet_protocol(host); err != nil {
+		t.Fatalf("extraSet failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseLongBreak || room.Timer.RemainingTime() != 900*time.Second {
+		t.Fatalf("expected a 900s long break, got %s with %v", room.Timer.Phase, room.Timer.RemainingTime())
+	}
+
+	data, err := json.Marshal(room.Timer)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var wire map[string]interface{}
+	json.Unmarshal(data, &wire)
+	if wire["duration"] != 900.0 || wire["phase"] != "longBreak" {
+		t.Fatalf("expected duration in seconds and the phase on the wire, got %v %v", wire["duration"], wire["phase"])
+	}
+
+	if err := room.skipBreak_protocol(host); err != nil {
+		t.Fatalf("skipBreak failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseFocus || room.Timer.RemainingTime() != 1500*time.Second {
+		t.Fatal("expected focus to start right after skipping the break")
+	}
+	if err := room.end_protocol(host); err != nil {
+		t.Fatalf("end failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseCompleted || room.Timer.IsRunning {
+		t.Fatalf("expected a completed, stopped timer, got %s", room.Timer.Phase)
+	}
+}
+
+func TestEndPausedRoom(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := room.end_protocol(host); err != nil {
+		t.Fatalf("end failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseCompleted || room.Timer.IsPaused || !room.Timer.PausedAt.IsZero() {
+		t.Fatalf("expected a completed, unpaused timer, got %s paused=%v", room.Timer.Phase, room.Timer.IsPaused)
+	}
+
+	// The next session starts normally
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start after ending paused failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseFocus || room.Timer.RemainingTime() != 1500*time.Second {
+		t.Fatalf("expected a fresh focus block, got %s with %v", room.Timer.Phase, room.Timer.RemainingTime())
+	}
+}
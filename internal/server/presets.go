@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultPresetName is the preset new rooms start with.
+const DefaultPresetName = "Classic Pomodoro"
+
+// Preset is a named timer setup users can pick at create or updateConfig.
+type Preset struct {
+	Name  string      `json:"name"`
+	Timer TimerConfig `json:"timer"`
+}
+
+// builtinPresets are always available, a presets file can add to or override them.
+var builtinPresets = []Preset{
+	{
+		Name: "Classic Pomodoro",
+		Timer: TimerConfig{
+			FocusTime:       1500, // 25 minutes
+			ShortBreakTime:  300,  // 5 minutes
+			LongBreakTime:   900,  // 15 minutes
+			Sets:            3,
+			Pace:            2.0,
+			EventDifficulty: 1,
+			Warnings:        DefaultWarnings,
+		},
+	},
+	{
+		Name: "52/17",
+		Timer: TimerConfig{
+			FocusTime:       3120, // 52 minutes
+			ShortBreakTime:  1020, // 17 minutes
+			LongBreakTime:   1020,
+			Sets:            3,
+			Pace:            2.0,
+			EventDifficulty: 2,
+			Warnings:        DefaultWarnings,
+		},
+	},
+	{
+		Name: "Deep Work 90",
+		Timer: TimerConfig{
+			FocusTime:       5400, // 90 minutes
+			ShortBreakTime:  1200, // 20 minutes
+			LongBreakTime:   1800, // 30 minutes
+			Sets:            2,
+			Pace:            1.5,
+			AutoContinue:    true,
+			EventDifficulty: 3,
+			Warnings:        DefaultWarnings,
+		},
+	},
+}
+
+// LoadPresets reads extra presets from a JSON array at path. A missing file
+// yields no presets.
+func LoadPresets(path string) ([]Preset, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LoadPresets error: %v", err)
+	}
+	var presets []Preset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("LoadPresets error: %v", err)
+	}
+	for _, preset := range presets {
+		if err := preset.validate(); err != nil {
+			return nil, fmt.Errorf("LoadPresets error: %v", err)
+		}
+	}
+	return presets, nil
+}
+
+func (p Preset) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("preset name is required")
+	}
+	if p.Timer.FocusTime == 0 || p.Timer.Sets == 0 || p.Timer.Pace <= 0 {
+		return fmt.Errorf("preset %s needs a focus time, sets and pace", p.Name)
+	}
+	if err := p.Timer.validate(); err != nil {
+		return fmt.Errorf("preset %s: %v", p.Name, err)
+	}
+	if p.Timer.EventDifficulty > 3 {
+		return fmt.Errorf("preset %s event difficulty must be 0-3", p.Name)
+	}
+	return nil
+}
+
+func presetKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// AddPresets registers presets on the server, replacing any with the same name.
+func (s *Server) AddPresets(presets []Preset) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, preset := range presets {
+		s.Presets[presetKey(preset.Name)] = preset
+	}
+}
+
+// presetList returns the server's presets ordered by name.
+func (s *Server) presetList() []Preset {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	presets := make([]Preset, 0, len(s.Presets))
+	for _, preset := range s.Presets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets
+}
+
+// findPreset looks a preset up by case-insensitive name.
+func (r *Room) findPreset(name string) (Preset, error) {
+	preset, ok := r.presets[presetKey(name)]
+	if !ok {
+		return Preset{}, fmt.Errorf("Unknown preset %s", name)
+	}
+	return preset, nil
+}
+
+// applyPreset switches the room's timer to the named preset.
+func (r *Room) applyPreset(name string) error {
+	preset, err := r.findPreset(name)
+	if err != nil {
+		return err
+	}
+	r.Timer.applyConfig(preset.Timer)
+	r.Timer.TimerMux.Lock()
+	r.Timer.Preset = preset.Name
+	r.Timer.TimerMux.Unlock()
+	return nil
+}
+
+// listPresets_protocol sends the available presets to c.
+func (s *Server) listPresets_protocol(c *Client) {
+	packet := ServerPacket{
+		Header: Header{Protocol: "listPresets", UserId: c.Id},
+		Response: map[string]interface{}{
+			"type":    "direct",
+			"status":  "success",
+			"presets": s.presetList(),
+		},
+	}
+	select {
+	case c.MsgCh <- packet:
+	default:
+		s.removeClient(c)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPresetsApplyAtCreateAndUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "presets.json")
+	data := `[{"name": "Sprint", "timer": {"focusTime": 600, "shortBreakTime": 120, "longBreakTime": 300, "sets": 4, "pace": 3}}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	presets, err := LoadPresets(path)
+	if err != nil {
+		t.Fatalf("LoadPresets failed: %v", err)
+	}
+	s := NewServer("", 0)
+	s.AddPresets(presets)
+	if got := len(s.presetList()); got != len(builtinPresets)+1 {
+		t.Fatalf("expected %d presets, got %d", len(builtinPresets)+1, got)
+	}
+
+	room := s.newRoom("room1")
+	if room.Timer.Preset != DefaultPresetName || room.Timer.FocusTime != 1500 {
+		t.Fatalf("new room should start on %s, got %+v", DefaultPresetName, room.Timer.config())
+	}
+	if err := room.applyPreset("deep work 90"); err != nil {
+		t.Fatalf("applyPreset failed: %v", err)
+	}
+	if room.Timer.FocusTime != 5400 || room.Timer.EventDifficulty != 3 || room.Timer.Preset != "Deep Work 90" {
+		t.Fatalf("preset not applied: %+v", room.Timer.config())
+	}
+	if err := room.applyPreset("Unknown"); err == nil {
+		t.Fatal("expected unknown preset to be rejected")
+	}
+
+	host := newTestHiker("1")
+	if err := room.create_protocol(host, nil); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if err := room.updateConfig_protocol(host, "Sprint", nil, nil, nil); err != nil {
+		t.Fatalf("updateConfig with preset failed: %v", err)
+	}
+	if room.Timer.FocusTime != 600 || room.Timer.Sets != 4 || room.Timer.Preset != "Sprint" {
+		t.Fatalf("file preset not applied: %+v", room.Timer.config())
+	}
+
+	// Hand-edited timers no longer belong to a preset
+	if err := room.updateConfig_protocol(host, "", map[string]interface{}{"focusTime": 900}, nil, nil); err != nil {
+		t.Fatalf("updateConfig failed: %v", err)
+	}
+	if room.Timer.FocusTime != 900 || room.Timer.Preset != "" {
+		t.Fatalf("manual edit should clear the preset: %+v", room.Timer)
+	}
+
+	// A preset whose overrides fail validation isn't applied
+	if err := room.updateConfig_protocol(host, "Sprint", map[string]interface{}{"breakRatio": -1}, nil, nil); err == nil {
+		t.Fatal("expected a negative breakRatio to be rejected")
+	}
+	if room.Timer.FocusTime != 900 || room.Timer.Preset != "" {
+		t.Fatalf("a rejected preset was applied: %+v", room.Timer.config())
+	}
+}
+
+func TestEndKeepsPresetPace(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.presets = map[string]Preset{}
+	for _, preset := range builtinPresets {
+		room.presets[presetKey(preset.Name)] = preset
+	}
+	if err := room.updateConfig_protocol(host, "Deep Work 90", nil, nil, nil); err != nil {
+		t.Fatalf("updateConfig with preset failed: %v", err)
+	}
+
+	for session := 0; session < 2; session++ {
+		if err := room.start_protocol(host); err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+		clock.Advance(time.Hour)
+		if err := room.end_protocol(host); err != nil {
+			t.Fatalf("end failed: %v", err)
+		}
+		if room.Timer.Pace != 1.5 || room.Timer.Preset != "Deep Work 90" {
+			t.Fatalf("expected the preset's pace after end, got %v on %q", room.Timer.Pace, room.Timer.Preset)
+		}
+	}
+}
@@ -4,17 +4,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"time"
+	"slices"
 )
 
 // Responds to room with Header + "hiker Joined the room"
 func (r *Room) join_protocol(h *Client) error {
 	fmt.Println("Hiker join protocol, amount of hikers in room before adding:", len(r.Hikers))
+	if r.isBanned(h) {
+		r.sendError(h, "You are banned from this room")
+		return fmt.Errorf("hiker %s is banned from room %s", h.Id, r.Id)
+	}
 	err := r.AddHiker(h)
+	if err == errRoomFull {
+		r.joinWaitlist(h)
+		return nil
+	}
 	if err != nil {
+		r.sendError(h, err.Error())
 		return fmt.Errorf("error in join_protocol: %v", err)
 	}
 	fmt.Println("After AddHiker, amount of hikers in room:", len(r.Hikers))
+	r.addMember(h)
 
 	// Broadcast the updated list
 	return r.responseFactory("join", h)
@@ -22,10 +32,22 @@ func (r *Room) join_protocol(h *Client) error {
 
 // Responds to CLient witha Header + "welcome"
 // Joins new user to room
-func (r *Room) create_protocol(h *Client) error {
+func (r *Room) create_protocol(h *Client, roomConfig interface{}) error {
+	// Apply any room settings sent with create
+	if err := r.applyRoomConfig(roomConfig); err != nil {
+		r.sendError(h, err.Error())
+	}
+
 	// Add hiker to room
 	r.AddHiker(h)
 
+	// Persistent rooms start from the settings they were created with
+	if r.Persistent {
+		r.captureDefaults()
+		r.addMember(h)
+		r.persist()
+	}
+
 	return r.responseFactory("create", h)
 
 }
@@ -41,47 +63,116 @@ func (r *Room) ready_protocol(h *Client) error {
 	}
 	return nil
 }
-func (r *Room) updateConfig_protocol(cl *Client, timerConfig interface{}, sessionConfig interface{}) error {
+
+// updateConfig_protocol applies the named preset, if any, then the timer,
+// session and room config fields sent by the client. Every part is decoded
+// and validated before any is applied, so a bad field changes nothing.
+func (r *Room) updateConfig_protocol(cl *Client, preset string, timerConfig interface{}, sessionConfig interface{}, roomConfig interface{}) error {
+	if !r.isHostOrCoHost(cl) {
+		r.sendError(cl, "Only the host or a co-host can change the room settings")
+		return fmt.Errorf("error in updateConfig_protocol: %s is not the host or a co-host", cl.Id)
+	}
+	// Distance so far accrues at the old pace
+	r.accrue()
 	r.Session.SessionMux.Lock()
 	defer r.Session.SessionMux.Unlock()
 
 	r.Timer.TimerMux.Lock()
 	defer r.Timer.TimerMux.Unlock()
+	before := r.configSnapshot()
+	previous := r.Timer.settings()
 	// Debug print before updating
 	fmt.Printf("r.Timer before update protocol: %+v\n", r.Timer)
 	fmt.Printf("r.Session before update protocol: %+v\n", r.Session)
 
-	// Marshal the sessionConfig into JSON
+	// Merge the sessionConfig over a copy of the session
+	updatedSession := r.Session.copy()
 	sessionJsonResult, err := json.Marshal(sessionConfig)
 	if err != nil {
 		return fmt.Errorf("Error marshaling updated session config: %v", err)
 	}
-	// Unmarshal the JSON result into r.Session
-	err = json.Unmarshal(sessionJsonResult, &r.Session)
+	err = json.Unmarshal(sessionJsonResult, updatedSession)
 	if err != nil {
 		return fmt.Errorf("Error unmarshaling updated session config: %v", err)
 	}
 
+	// Start from the preset, or the current settings
+	updatedTimer, updatedPreset := r.Timer.settings(), r.Timer.Preset
+	if preset != "" {
+		p, err := r.findPreset(preset)
+		if err != nil {
+			return err
+		}
+		updatedTimer, updatedPreset = p.Timer, p.Name
+		// Unmarshal may write into the slices, keep the preset's own
+		updatedTimer.Warnings = slices.Clone(p.Timer.Warnings)
+		updatedTimer.Intervals = slices.Clone(p.Timer.Intervals)
+	} else if timerConfig != nil {
+		// Hand-picked values no longer match a preset
+		updatedPreset = ""
+	}
+
 	// Marshal the timerConfig into JSON
 	timerJsonResult, err := json.Marshal(timerConfig)
 	if err != nil {
 		return fmt.Errorf("Error marshaling updated timer config: %v", err)
 	}
-	// Unmarshal the JSON result into r.Timer
-	err = json.Unmarshal(timerJsonResult, &r.Timer)
+	// Merge it over those settings, the phase and progress can't be set
+	err = json.Unmarshal(timerJsonResult, &updatedTimer)
 	if err != nil {
 		return fmt.Errorf("Error unmarshaling updated timer config: %v", err)
 	}
-	r.Timer.Duration = time.Duration(r.Timer.FocusTime) * time.Second // time.Duration(r.Timer.FocusTime + "s") * time.Second
+	if err := updatedTimer.validate(); err != nil {
+		return err
+	}
+	phase := r.Timer.currentPhase()
+	if phase != PhaseIdle && phase != PhaseCompleted && !slices.Equal(updatedTimer.Intervals, previous.Intervals) {
+		return fmt.Errorf("Intervals can only be replaced between sessions, use editIntervals")
+	}
+	if phase != PhaseIdle && phase != PhaseCompleted && (updatedTimer.Flowtime != previous.Flowtime || updatedTimer.BreakRatio != previous.BreakRatio) {
+		// Focus already running open-ended, or counting down, can't switch modes
+		return fmt.Errorf("Flowtime and breakRatio can only be changed between sessions")
+	}
+
+	updatedRoom, err := r.decodeRoomConfig(roomConfig)
+	if err != nil {
+		return fmt.Errorf("Error applying room config: %v", err)
+	}
+
+	// Everything is valid, apply it together
+	r.Session.assign(updatedSession)
+	r.Timer.setConfig(updatedTimer)
+	r.Timer.Preset = updatedPreset
+	if phase == PhaseIdle {
+		// Preview the first focus block, a running phase keeps its length
+		r.Timer.IntervalIndex = 0
+		r.Timer.Duration = toDuration(r.Timer.phaseLength(PhaseFocus))
+	}
+	if phase == PhaseFocus && !r.Timer.IsPaused {
+		// The update cadence may follow the new pace
+		r.Timer.startUpdates(r)
+	}
+	r.ConfigMux.Lock()
+	r.Config = updatedRoom
+	r.ConfigMux.Unlock()
+
 	// Debug print after updating
 	fmt.Printf("r.Timer after update protocol: %+v\n", r.Timer)
 	fmt.Printf("r.Session after update protocol: %+v\n", r.Session)
 
+	r.audit(cl, "updateConfig", map[string]interface{}{
+		"before": before,
+		"after":  r.configSnapshot(),
+	})
 	return nil
 }
 
 func (r *Room) pauseHiker_protocol(h *Client) error {
 	fmt.Println("Hiker pause protocol")
+	// Settle the distance covered before the pause
+	r.accrueMux.Lock()
+	defer r.accrueMux.Unlock()
+	r.accrueLocked()
 	r.Session.SessionMux.Lock()
 	defer r.Session.SessionMux.Unlock()
 	h.mux.Lock()
@@ -108,103 +199,272 @@ func (r *Room) pauseHiker_protocol(h *Client) error {
 			r.Session.Distance -= sessionPenalty
 		}
 	}
-	levelDistanceFactor := 0.5 // Distance required per level increment
 	r.Session.Level = uint8(math.Floor(r.Session.Distance/levelDistanceFactor) + 1)
 
 	return nil
 }
 func (r *Room) resumeHiker_protocol(h *Client) error {
+	// The paused time doesn't count
+	r.accrueMux.Lock()
+	defer r.accrueMux.Unlock()
+	r.accrueLocked()
 	if !h.IsPaused {
 		return fmt.Errorf("hiker is not paused")
 	}
 	h.IsPaused = false
 	return nil
 }
+
+// pauseRoom_protocol lets the host or a co-host pause the whole room without
+// any strike or distance penalty.
+func (r *Room) pauseRoom_protocol(h *Client) error {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host or a co-host can pause the room")
+		return fmt.Errorf("error in pauseRoom_protocol: %s is not the host or a co-host", h.Id)
+	}
+	if err := r.Timer.Pause(); err != nil {
+		r.sendError(h, "Cannot pause: "+err.Error())
+		return fmt.Errorf("error in pauseRoom_protocol: %v", err)
+	}
+	r.audit(h, "pauseRoom", r.Timer.addPhaseTime(map[string]interface{}{}))
+	return r.broadcast("roomPaused", r.Timer.addPhaseTime(map[string]interface{}{
+		"type":    "broadcast",
+		"message": fmt.Sprintf("%s paused the room", h.Username),
+		"timer":   r.Timer,
+	}))
+}
+
+// resumeRoom_protocol picks a paused room up where it left off.
+func (r *Room) resumeRoom_protocol(h *Client) error {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host or a co-host can resume the room")
+		return fmt.Errorf("error in resumeRoom_protocol: %s is not the host or a co-host", h.Id)
+	}
+	if err := r.Timer.Resume(r); err != nil {
+		r.sendError(h, "Cannot resume: "+err.Error())
+		return fmt.Errorf("error in resumeRoom_protocol: %v", err)
+	}
+	r.audit(h, "resumeRoom", r.Timer.addPhaseTime(map[string]interface{}{}))
+	return r.broadcast("roomResumed", r.Timer.addPhaseTime(map[string]interface{}{
+		"type":    "broadcast",
+		"message": fmt.Sprintf("%s resumed the room", h.Username),
+		"timer":   r.Timer,
+	}))
+}
+
 func (r *Room) end_protocol(h *Client) error {
+	if err := r.checkDecision(h); err != nil {
+		r.sendError(h, err.Error())
+		return fmt.Errorf("error in end_protocol: %v", err)
+	}
+	r.accrue()
+	// End stops the countdown and waits for the update goroutine
+	if err := r.Timer.End(r); err != nil {
+		r.sendError(h, "Cannot end: "+err.Error())
+		return fmt.Errorf("error in end_protocol: %v", err)
+	}
+	r.cancelDecision()
+
 	r.Timer.TimerMux.Lock()
 	defer r.Timer.TimerMux.Unlock()
 	r.Session.SessionMux.Lock()
 	defer r.Session.SessionMux.Unlock()
 	r.HikersMux.Lock()
 	defer r.HikersMux.Unlock()
-	r.Timer.StopTicker()
-	r.Timer.CountdownTimer.Stop()
-	r.Timer.IsRunning = false
-	r.Timer.IsBreak = false
+	completedSets := r.Timer.CompletedSets
+	distance := r.Session.Distance
+	overtimeDistance := r.Session.OvertimeDistance
+	// The pace is part of the room's timer settings and carries over
 	r.Timer.CompletedSets = 0
-	r.Timer.Pace = 2.0
 	for _, hiker := range r.Hikers {
 		hiker.IsReady = false
 		hiker.IsPaused = false
+		hiker.FocusStopped = false
+		hiker.Overtime = false
+		hiker.OvertimeDistance = 0.00
 		hiker.Strikes = 0
 		hiker.droppedMessages = 0
 		hiker.Distance = 0.00
 	}
 	r.Session.Distance = 0.00
+	r.Session.OvertimeDistance = 0.00
 	r.Session.Level = 1
 	r.Session.Strikes = 0
 	r.Session.BonusTokens = 0
 	r.Session.TokensEarned = 0
 	r.Session.HighestCompletedLevel = 0
 
+	r.audit(h, "end", map[string]interface{}{
+		"completedSets":    completedSets,
+		"distance":         distance,
+		"overtimeDistance": overtimeDistance,
+	})
 	return nil
 }
 
-func (r *Room) start_protocol() {
-	r.Timer.TimerMux.Lock()
-	r.Timer.IsRunning = true
-	r.Timer.TimerMux.Unlock()
-	r.Timer.BeginFocusTime(r)
+func (r *Room) start_protocol(h *Client) error {
+	if err := r.Timer.Start(r); err != nil {
+		r.sendError(h, "Cannot start: "+err.Error())
+		return fmt.Errorf("error in start_protocol: %v", err)
+	}
+	// Starting by hand replaces any scheduled or auto start
+	r.cancelSchedule()
+	r.cancelAutoStart()
 
+	r.audit(h, "start", nil)
+	return nil
 }
 func (r *Room) leave_protocol(h *Client) error {
-	r.RemoveHiker(h)
+	// Leaving on purpose hands the host role over right away
+	r.dropHiker(h, 0)
+	h.setRoomId("")
 
 	return nil
 }
 
-func (r *Room) extraSet_protocol() error {
-	r.Timer.ExtraSet(r)
+func (r *Room) extraSet_protocol(h *Client) error {
+	if err := r.checkDecision(h); err != nil {
+		r.sendError(h, err.Error())
+		return fmt.Errorf("error in extraSet_protocol: %v", err)
+	}
+	if err := r.Timer.ExtraSet(r); err != nil {
+		r.sendError(h, "Cannot add a set: "+err.Error())
+		return fmt.Errorf("error in extraSet_protocol: %v", err)
+	}
+	r.cancelDecision()
+	r.audit(h, "extraSet", map[string]interface{}{"sets": r.Timer.Sets})
 	return nil
 }
-func (r *Room) extraSession_protocol() error {
-	r.Timer.ExtraSession(r)
+func (r *Room) extraSession_protocol(h *Client) error {
+	if err := r.checkDecision(h); err != nil {
+		r.sendError(h, err.Error())
+		return fmt.Errorf("error in extraSession_protocol: %v", err)
+	}
+	if err := r.Timer.ExtraSession(r); err != nil {
+		r.sendError(h, "Cannot add a session: "+err.Error())
+		return fmt.Errorf("error in extraSession_protocol: %v", err)
+	}
+	r.cancelDecision()
+	r.audit(h, "extraSession", map[string]interface{}{"sets": r.Timer.Sets})
 	return nil
 }
 
-func (r *Room) skipBreak_protocol() error {
-	r.Timer.SkipBreak(r)
+func (r *Room) skipBreak_protocol(h *Client) error {
+	if err := r.Timer.SkipBreak(r); err != nil {
+		r.sendError(h, "Cannot skip: "+err.Error())
+		return fmt.Errorf("error in skipBreak_protocol: %v", err)
+	}
 	return nil
 }
 
 func (r *Room) update_protocol() error {
+	// Only focus time adds distance, breaks and pauses still get the update
+	r.accrue()
+	r.HikersMux.RLock()
+	host := r.Hikers[r.Host]
+	r.HikersMux.RUnlock()
+	return r.responseFactory("update", host)
+}
 
-	r.Timer.TimerMux.RLock()
-	//should not be updating during break or pause
-	if r.Timer.IsBreak {
-		r.Timer.TimerMux.RUnlock()
-		return r.responseFactory("update", r.Hikers[r.Host])
+// kick_protocol lets the host remove a hiker, who may rejoin later.
+func (r *Room) kick_protocol(h *Client, targetId string) error {
+	target, err := r.moderationTarget(h, targetId)
+	if err != nil {
+		return fmt.Errorf("error in kick_protocol: %v", err)
+	}
+	r.audit(h, "kick", map[string]interface{}{
+		"userId":   target.Id,
+		"username": target.Username,
+	})
+	return r.kickHiker(target, "kicked", "You have been kicked from the room")
+}
 
+// ban_protocol removes a hiker and records a ban so they cannot rejoin.
+// When banIp is set the hiker's IP is banned as well.
+func (r *Room) ban_protocol(h *Client, targetId string, reason string, banIp bool) error {
+	target, err := r.moderationTarget(h, targetId)
+	if err != nil {
+		return fmt.Errorf("error in ban_protocol: %v", err)
 	}
-	r.Timer.TimerMux.RUnlock()
+	ban := &Ban{
+		UserId:   target.Id,
+		Username: target.Username,
+		Reason:   reason,
+		BannedBy: h.Id,
+		BannedAt: r.clock().Now(),
+	}
+	if banIp {
+		ban.Ip = target.Ip
+	}
+	r.addBan(ban)
+	r.audit(h, "ban", map[string]interface{}{
+		"userId":   target.Id,
+		"username": target.Username,
+		"reason":   reason,
+		"ipBanned": banIp,
+	})
 
-	//update all hikers distance +.01 if not paused
-	r.HikersMux.Lock()
-	for _, hiker := range r.Hikers {
-		if !hiker.IsPaused {
-			//increase hiker Distance
-			hiker.Distance += 0.01
-			//increase session total Distance
-			r.Session.Distance += 0.01
-		}
+	notice := "You have been banned from the room"
+	if reason != "" {
+		notice += ": " + reason
 	}
-	levelDistanceFactor := 0.5 // Distance required per level increment
-	r.Session.Level = uint8(math.Floor(r.Session.Distance/levelDistanceFactor) + 1)
+	return r.kickHiker(target, "banned", notice)
+}
+
+func (r *Room) unban_protocol(h *Client, targetId string) error {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host can unban hikers")
+		return fmt.Errorf("error in unban_protocol: %s is not the host", h.Id)
+	}
+	if !r.removeBan(targetId) {
+		r.sendError(h, "No ban found for that hiker")
+		return fmt.Errorf("error in unban_protocol: no ban for %s", targetId)
+	}
+	r.audit(h, "unban", map[string]interface{}{"userId": targetId})
+	return r.listBans_protocol(h)
+}
 
-	if r.Session.Level > r.Session.HighestCompletedLevel {
-		r.Session.HighestCompletedLevel = r.Session.Level
+// listBans_protocol sends the room's ban list directly to the host.
+func (r *Room) listBans_protocol(h *Client) error {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host can view bans")
+		return fmt.Errorf("error in listBans_protocol: %s is not the host", h.Id)
+	}
+	packet, err := r.packMessage("listBans", map[string]interface{}{
+		"type":   "direct",
+		"status": "success",
+		"bans":   r.banList(),
+	}, h)
+	if err != nil {
+		return fmt.Errorf("error in listBans_protocol: %v", err)
 	}
-	r.HikersMux.Unlock()
+	r.sendMessage(h, packet)
+	return nil
+}
 
-	return r.responseFactory("update", r.Hikers[r.Host])
+// moderationTarget checks that h may moderate and returns the hiker with targetId.
+func (r *Room) moderationTarget(h *Client, targetId string) (*Client, error) {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host can remove hikers")
+		return nil, fmt.Errorf("%s is not the host", h.Id)
+	}
+	if targetId == h.Id {
+		r.sendError(h, "You cannot remove yourself")
+		return nil, fmt.Errorf("host %s targeted themselves", h.Id)
+	}
+	if targetId == r.Host {
+		r.sendError(h, "The host cannot be removed")
+		return nil, fmt.Errorf("%s targeted the host", h.Id)
+	}
+	r.HikersMux.RLock()
+	target, ok := r.Hikers[targetId]
+	if !ok {
+		target, ok = r.Spectators[targetId]
+	}
+	r.HikersMux.RUnlock()
+	if !ok {
+		r.sendError(h, "Hiker is not in this room")
+		return nil, fmt.Errorf("hiker %s not found", targetId)
+	}
+	return target, nil
 }
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Ready policies decide who must be ready before the session can start.
+const (
+	ReadyAny    = ""       // Start whenever asked, the default
+	ReadyAll    = "all"    // Every hiker must be ready
+	ReadyQuorum = "quorum" // At least ReadyQuorum of the hikers must be ready
+)
+
+// ReadyTally counts ready hikers against the room's ready policy. Spectators
+// are never counted.
+type ReadyTally struct {
+	Ready    int    `json:"ready"`
+	Total    int    `json:"total"`
+	Required int    `json:"required"` // Ready hikers needed to start
+	Policy   string `json:"policy"`
+	Met      bool   `json:"met"`
+}
+
+// readyTally counts the room's ready hikers.
+func (r *Room) readyTally() ReadyTally {
+	r.ConfigMux.RLock()
+	policy := r.Config.ReadyPolicy
+	quorum := r.Config.ReadyQuorum
+	r.ConfigMux.RUnlock()
+
+	tally := ReadyTally{Policy: policy}
+	r.HikersMux.RLock()
+	tally.Total = len(r.Hikers)
+	for _, hiker := range r.Hikers {
+		if hiker.IsReady {
+			tally.Ready++
+		}
+	}
+	r.HikersMux.RUnlock()
+
+	switch policy {
+	case ReadyAll:
+		tally.Required = tally.Total
+	case ReadyQuorum:
+		tally.Required = int(math.Ceil(quorum * float64(tally.Total)))
+	}
+	tally.Met = tally.Total > 0 && tally.Ready >= tally.Required
+	return tally
+}
+
+// autoStartReady reports whether the auto start may run: the ready policy is
+// met, or everyone is ready when there is no policy.
+func (t ReadyTally) autoStartReady() bool {
+	if t.Policy == ReadyAny {
+		return t.Total > 0 && t.Ready == t.Total
+	}
+	return t.Met
+}
+
+// canStart checks the ready policy before h starts the session. The host or a
+// co-host may force a start past an unmet policy.
+func (r *Room) canStart(h *Client, force bool) error {
+	tally := r.readyTally()
+	if tally.Met {
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("Waiting for hikers to be ready (%d/%d)", tally.Ready, tally.Required)
+	}
+	if !r.isHostOrCoHost(h) {
+		return fmt.Errorf("Only the host or a co-host can force a start")
+	}
+	r.audit(h, "forceStart", map[string]interface{}{"tally": tally})
+	return nil
+}
+
+// checkReady broadcasts the ready tally and starts or cancels the auto start
+// countdown. With AutoStartDelay set the session starts that many seconds after
+// the ready policy is met, or once everyone is ready when there is no policy.
+func (r *Room) checkReady() {
+	tally := r.readyTally()
+	r.broadcast("readyTally", map[string]interface{}{
+		"type":  "broadcast",
+		"tally": tally,
+	})
+
+	r.ConfigMux.RLock()
+	delay := time.Duration(r.Config.AutoStartDelay) * time.Second
+	r.ConfigMux.RUnlock()
+	r.Timer.TimerMux.RLock()
+	running := r.Timer.IsRunning
+	r.Timer.TimerMux.RUnlock()
+
+	ready := tally.autoStartReady()
+
+	r.readyMux.Lock()
+	armed := r.readyCountdown != nil
+	switch {
+	case ready && delay > 0 && !running && !armed:
+		at := r.clock().Now().Add(delay)
+		r.readyAt = at
+		r.readyCountdown = r.clock().AfterFunc(delay, func() {
+			r.enqueue("autoStart", map[string]interface{}{"at": at})
+		})
+		r.readyMux.Unlock()
+		r.broadcast("autoStart", map[string]interface{}{
+			"type":     "broadcast",
+			"event":    "countdown",
+			"startsIn": delay.Seconds(),
+			"tally":    tally,
+			"message":  fmt.Sprintf("Hikers are ready, starting in %s", delay),
+		})
+	case armed && (!ready || delay == 0 || running):
+		r.readyCountdown.Stop()
+		r.readyCountdown = nil
+		r.readyMux.Unlock()
+		r.broadcast("autoStart", map[string]interface{}{
+			"type":    "broadcast",
+			"event":   "cancelled",
+			"tally":   tally,
+			"message": "Auto start cancelled",
+		})
+	default:
+		r.readyMux.Unlock()
+	}
+}
+
+// cancelAutoStart stops a pending auto start without telling the room.
+func (r *Room) cancelAutoStart() {
+	r.readyMux.Lock()
+	defer r.readyMux.Unlock()
+	if r.readyCountdown != nil {
+		r.readyCountdown.Stop()
+		r.readyCountdown = nil
+	}
+}
+
+// autoStart runs on the room goroutine when the auto start countdown that
+// ends at at is over.
+func (r *Room) autoStart(at time.Time) {
+	r.readyMux.Lock()
+	if r.readyCountdown == nil || !r.readyAt.Equal(at) {
+		// Cancelled or rearmed while this countdown fired
+		r.readyMux.Unlock()
+		return
+	}
+	r.readyCountdown = nil
+	r.readyMux.Unlock()
+	// Hikers may have disconnected during the countdown
+	if !r.readyTally().autoStartReady() {
+		fmt.Printf("Skipping auto start of room %s, hikers are no longer ready\n", r.Id)
+		return
+	}
+	r.startUnattended("auto")
+}
+
+// startUnattended starts the session through the normal start path on the
+// server's behalf. Nothing happens if the room is closed, empty or running.
+// Callers run on the room goroutine, so no hiker's start can come in between
+// the check and the start.
+func (r *Room) startUnattended(reason string) {
+	r.HikersMux.RLock()
+	hikers := len(r.Hikers)
+	r.HikersMux.RUnlock()
+	r.Timer.TimerMux.RLock()
+	running := r.Timer.IsRunning
+	r.Timer.TimerMux.RUnlock()
+	if r.isClosed() || hikers == 0 || running {
+		fmt.Printf("Skipping %s start of room %s\n", reason, r.Id)
+		return
+	}
+
+	fmt.Printf("Starting %s session in room %s\n", reason, r.Id)
+	if err := r.start_protocol(nil); err != nil {
+		fmt.Printf("error in startUnattended: %v\n", err)
+		return
+	}
+	err := r.responseFactory("start", nil)
+	if err != nil {
+		fmt.Printf("error in startUnattended: %v\n", err)
+	}
+	r.touch()
+	r.publishLobby()
+}
@@ -0,0 +1,76 @@
+package server
+
+import "testing"
+
+func TestReadyPolicyGatesStart(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	other := newTestHiker("3")
+	room := newTestRoom(host, hiker, other)
+
+	if err := room.canStart(hiker, false); err != nil {
+		t.Fatalf("rooms without a policy should start right away: %v", err)
+	}
+	if err := room.applyRoomConfig(map[string]interface{}{"readyPolicy": "quorum", "readyQuorum": 1.5}); err == nil {
+		t.Fatal("expected an invalid quorum to be rejected")
+	}
+	if err := room.applyRoomConfig(map[string]interface{}{"readyPolicy": "quorum", "readyQuorum": 0.5}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+
+	host.IsReady = true
+	if tally := room.readyTally(); tally.Required != 2 || tally.Met {
+		t.Fatalf("unexpected tally %+v", tally)
+	}
+	if err := room.canStart(hiker, false); err == nil {
+		t.Fatal("expected start to wait for the quorum")
+	}
+	if err := room.canStart(hiker, true); err == nil {
+		t.Fatal("only the host or a co-host can force a start")
+	}
+	if err := room.canStart(host, true); err != nil {
+		t.Fatalf("host force start failed: %v", err)
+	}
+
+	// Spectators don't count toward the tally
+	spectator := newTestHiker("4")
+	spectator.IsReady = true
+	room.Spectators = map[string]*Client{spectator.Id: spectator}
+	hiker.IsReady = true
+	if tally := room.readyTally(); tally.Ready != 2 || tally.Total != 3 || !tally.Met {
+		t.Fatalf("unexpected tally %+v", tally)
+	}
+}
+
+func TestAutoStartCountdown(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	room := newTestRoom(host, hiker)
+	defer room.Timer.Stop()
+	serveRoom(t, room)
+	if err := room.applyRoomConfig(map[string]interface{}{"readyPolicy": "all"}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+	room.Config.AutoStartDelay = 1
+
+	host.IsReady = true
+	hiker.IsReady = true
+	room.checkReady()
+	if event := lastPacket(t, hiker).Response["event"]; event != "countdown" {
+		t.Fatalf("expected countdown, got %v", event)
+	}
+
+	// Someone un-readies and the countdown is called off
+	hiker.IsReady = false
+	room.checkReady()
+	if event := lastPacket(t, hiker).Response["event"]; event != "cancelled" {
+		t.Fatalf("expected cancelled, got %v", event)
+	}
+
+	hiker.IsReady = true
+	room.checkReady()
+	waitForProtocol(t, hiker, "start")
+	if !room.Timer.IsRunning {
+		t.Fatal("expected the auto start to run the timer")
+	}
+}
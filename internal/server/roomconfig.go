@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxRoomNameLength  = 48
+	maxRoomTopicLength = 120
+	maxRoomTags        = 5
+	maxRoomTagLength   = 24
+	maxAutoStartDelay  = 300
+)
+
+// RoomConfig holds the room-level settings a host can change through the
+// roomConfig field of create and updateConfig.
+type RoomConfig struct {
+	MaxHikers int `json:"maxHikers"` // 0 means the server limit, or unlimited if there is none
+
+	// Public rooms are listed in the lobby under Name, Topic and Tags
+	Public bool     `json:"public"`
+	Name   string   `json:"name"`
+	Topic  string   `json:"topic"`
+	Tags   []string `json:"tags"`
+
+	// ReadyPolicy is ReadyAny, ReadyAll or ReadyQuorum
+	ReadyPolicy string  `json:"readyPolicy"`
+	ReadyQuorum float64 `json:"readyQuorum"` // Fraction of hikers, used by ReadyQuorum
+	// AutoStartDelay starts the session this many seconds after the hikers
+	// are ready, 0 to wait for the host
+	AutoStartDelay int `json:"autoStartDelay"`
+	// MaxTimeAdjustment caps how many seconds adjustTime can add to or take
+	// off a phase in total, 0 means DefaultMaxTimeAdjustment
+	MaxTimeAdjustment int `json:"maxTimeAdjustment"`
+	// DecisionTimeout is how many seconds the end modal waits before taking
+	// DecisionDefault, 0 means DefaultDecisionTimeout
+	DecisionTimeout int    `json:"decisionTimeout"`
+	DecisionDefault string `json:"decisionDefault"` // DecisionEnd when empty
+
+	// ScheduledStart starts the session automatically, nil when unscheduled
+	ScheduledStart *time.Time `json:"scheduledStart"`
+}
+
+// applyRoomConfig merges the fields present in config over the room's
+// current settings and validates the result.
+func (r *Room) applyRoomConfig(config interface{}) error {
+	updated, err := r.decodeRoomConfig(config)
+	if err != nil {
+		return err
+	}
+	r.ConfigMux.Lock()
+	r.Config = updated
+	r.ConfigMux.Unlock()
+	return nil
+}
+
+// decodeRoomConfig is applyRoomConfig without the apply: it returns the
+// merged and validated settings, leaving the room's unchanged.
+func (r *Room) decodeRoomConfig(config interface{}) (RoomConfig, error) {
+	r.ConfigMux.RLock()
+	defer r.ConfigMux.RUnlock()
+	if config == nil {
+		return r.Config, nil
+	}
+
+	updated := r.Config
+	updated.Tags = append([]string(nil), r.Config.Tags...) // Don't let Unmarshal write into the live slice
+	if r.Config.ScheduledStart != nil {
+		scheduledStart := *r.Config.ScheduledStart
+		updated.ScheduledStart = &scheduledStart
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return RoomConfig{}, fmt.Errorf("Error marshaling room config: %v", err)
+	}
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return RoomConfig{}, fmt.Errorf("Error unmarshaling room config: %v", err)
+	}
+
+	if updated.MaxHikers < 0 {
+		return RoomConfig{}, fmt.Errorf("maxHikers cannot be negative")
+	}
+	if r.ServerMaxHikers > 0 && updated.MaxHikers > r.ServerMaxHikers {
+		return RoomConfig{}, fmt.Errorf("maxHikers cannot exceed the server limit of %d", r.ServerMaxHikers)
+	}
+
+	updated.Name = strings.TrimSpace(updated.Name)
+	updated.Topic = strings.TrimSpace(updated.Topic)
+	if utf8.RuneCountInString(updated.Name) > maxRoomNameLength {
+		return RoomConfig{}, fmt.Errorf("Room name must be at most %d characters", maxRoomNameLength)
+	}
+	if utf8.RuneCountInString(updated.Topic) > maxRoomTopicLength {
+		return RoomConfig{}, fmt.Errorf("Room topic must be at most %d characters", maxRoomTopicLength)
+	}
+	if updated.Public && updated.Name == "" {
+		return RoomConfig{}, fmt.Errorf("Public rooms need a name")
+	}
+	if len(updated.Tags) > maxRoomTags {
+		return RoomConfig{}, fmt.Errorf("Rooms can have at most %d tags", maxRoomTags)
+	}
+	tags := make([]string, 0, len(updated.Tags))
+	for _, tag := range updated.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || containsString(tags, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxRoomTagLength {
+			return RoomConfig{}, fmt.Errorf("Tags must be at most %d characters", maxRoomTagLength)
+		}
+		tags = append(tags, tag)
+	}
+	updated.Tags = tags
+
+	switch updated.ReadyPolicy {
+	case ReadyAny, ReadyAll:
+	case ReadyQuorum:
+		if updated.ReadyQuorum <= 0 || updated.ReadyQuorum > 1 {
+			return RoomConfig{}, fmt.Errorf("readyQuorum must be greater than 0 and at most 1")
+		}
+	default:
+		return RoomConfig{}, fmt.Errorf("Unknown readyPolicy %s", updated.ReadyPolicy)
+	}
+	if updated.AutoStartDelay < 0 || updated.AutoStartDelay > maxAutoStartDelay {
+		return RoomConfig{}, fmt.Errorf("autoStartDelay must be between 0 and %d seconds", maxAutoStartDelay)
+	}
+
+	if updated.MaxTimeAdjustment < 0 || updated.MaxTimeAdjustment > maxTimeAdjustment {
+		return RoomConfig{}, fmt.Errorf("maxTimeAdjustment must be between 0 and %d seconds", maxTimeAdjustment)
+	}
+
+	if updated.DecisionTimeout < 0 || updated.DecisionTimeout > maxDecisionTimeout {
+		return RoomConfig{}, fmt.Errorf("decisionTimeout must be between 0 and %d seconds", maxDecisionTimeout)
+	}
+	switch updated.DecisionDefault {
+	case "", DecisionEnd, DecisionExtraSet, DecisionExtraSession:
+	default:
+		return RoomConfig{}, fmt.Errorf("Unknown decisionDefault %s", updated.DecisionDefault)
+	}
+
+	if updated.ScheduledStart != nil {
+		scheduledStart := updated.ScheduledStart.UTC()
+		unchanged := r.Config.ScheduledStart != nil && r.Config.ScheduledStart.Equal(scheduledStart)
+		if !unchanged && !scheduledStart.After(r.clock().Now()) {
+			return RoomConfig{}, fmt.Errorf("scheduledStart must be in the future")
+		}
+		updated.ScheduledStart = &scheduledStart
+	}
+
+	return updated, nil
+}
+
+// capacity returns the effective hiker limit, 0 meaning unlimited.
+func (r *Room) capacity() int {
+	r.ConfigMux.RLock()
+	defer r.ConfigMux.RUnlock()
+	if r.Config.MaxHikers > 0 {
+		return r.Config.MaxHikers
+	}
+	return r.ServerMaxHikers
+}
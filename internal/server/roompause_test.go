@@ -0,0 +1,51 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoomPauseFreezesCountdown(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	room := newTestRoom(host, hiker)
+	room.Timer.FocusTime = 1
+	defer room.Timer.Stop()
+
+	if err := room.pauseRoom_protocol(host); err == nil {
+		t.Fatal("expected pausing an idle room to fail")
+	}
+	room.start_protocol(host)
+	time.Sleep(300 * time.Millisecond)
+
+	if err := room.pauseRoom_protocol(hiker); err == nil {
+		t.Fatal("expected a hiker to be refused")
+	}
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	paused := room.Timer.RemainingTime()
+	if paused <= 0 || paused > 750*time.Millisecond {
+		t.Fatalf("unexpected remaining time %v", paused)
+	}
+	if got := lastPacket(t, hiker).Response["remainingTime"]; got != paused.Seconds() {
+		t.Fatalf("expected roomPaused with %v remaining, got %v", paused.Seconds(), got)
+	}
+
+	// Well past the original end of focus time, nothing moves while paused
+	time.Sleep(time.Second)
+	if room.Timer.IsBreak || room.Timer.RemainingTime() != paused {
+		t.Fatal("timer moved while the room was paused")
+	}
+	if host.Strikes != 0 || room.Session.Strikes != 0 {
+		t.Fatal("a room pause should not strike anyone")
+	}
+
+	if err := room.resumeRoom_protocol(host); err != nil {
+		t.Fatalf("resumeRoom failed: %v", err)
+	}
+	if diff := paused - room.Timer.RemainingTime(); diff < 0 || diff > 50*time.Millisecond {
+		t.Fatalf("resume lost time: paused with %v, resumed with %v", paused, room.Timer.RemainingTime())
+	}
+	waitForProtocol(t, hiker, "shortBreak")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,13 +16,78 @@ type RoomInterface interface {
 }
 
 type Room struct {
-	Id           string
-	Hikers       map[string]*Client
-	HikersMux    sync.RWMutex
-	Session      *Session
-	IncomingMsgs chan *ClientPacket
-	Timer        *Timer
-	Host         string
+	Id             string
+	Hikers         map[string]*Client
+	HikersMux      sync.RWMutex
+	Session        *Session
+	IncomingMsgs   chan *ClientPacket
+	Timer          *Timer
+	Host           string
+	Bans           map[string]*Ban
+	BansMux        sync.RWMutex
+	UsernamePolicy string
+	Audit          AuditSink
+	Config         RoomConfig
+	ConfigMux      sync.RWMutex
+	// ServerMaxHikers is the server-wide room size limit, 0 when unlimited
+	ServerMaxHikers int
+	// Waitlist holds hikers waiting for a free spot, guarded by HikersMux
+	Waitlist []*Client
+	// Spectators watch the room without hiking, guarded by HikersMux
+	Spectators map[string]*Client
+	// CoHosts holds the user ids of appointed co-hosts, guarded by HikersMux
+	CoHosts map[string]bool
+	// HostGracePeriod is how long a disconnected host keeps the role before
+	// a successor is elected
+	HostGracePeriod time.Duration
+	hostGrace       ClockTimer
+	hostGraceAt     time.Time // When hostGrace ends, guarded by hostGraceMux
+	hostGraceMux    sync.Mutex
+
+	// StartReminders are the offsets before a scheduled start at which the
+	// room is reminded
+	StartReminders []time.Duration
+	scheduleMux    sync.Mutex
+	scheduleTimers []ClockTimer // Reminders and the auto start, guarded by scheduleMux
+	scheduledFor   time.Time    // Start the timers are armed for, guarded by scheduleMux
+
+	readyMux       sync.Mutex
+	readyCountdown ClockTimer // Pending auto start, guarded by readyMux
+	readyAt        time.Time  // When readyCountdown ends, guarded by readyMux
+
+	accrueMux sync.Mutex // Held while distance accrues, see accrue
+
+	decisionMux      sync.Mutex
+	decisionTimer    ClockTimer // Takes the default action on the end modal, guarded by decisionMux
+	decisionDeadline time.Time  // When decisionTimer fires, guarded by decisionMux
+
+	// Clock drives the timer, schedules and broadcast timeouts, the wall
+	// clock when nil
+	Clock Clock
+
+	CreatedAt    time.Time
+	lastActivity atomic.Int64 // Unix nanoseconds of the last message or timer transition
+
+	// Persistent rooms stay registered while empty and can be joined by Slug
+	Persistent     bool
+	Slug           string
+	Owner          string
+	Members        map[string]string // User id to username, guarded by HikersMux
+	DefaultTimer   TimerConfig
+	DefaultSession SessionConfig
+	store          *RoomStore
+
+	presets map[string]Preset // Keyed by lower case name
+
+	lobby       *Lobby
+	lobbyMux    sync.Mutex
+	lobbyListed *RoomSummary // Last listing sent to the lobby, nil while unlisted
+	closeOnce   sync.Once
+	closed      bool // Guarded by lobbyMux
+	// sendMux is held for reading while sending on IncomingMsgs, close takes
+	// it for writing so it never closes the channel under a sender
+	sendMux sync.RWMutex
+	done    chan struct{} // Closed when the room closes, unblocking senders
 }
 
 func (r *Room) handleRoomMessages() {
@@ -31,28 +97,60 @@ func (r *Room) handleRoomMessages() {
 			return // Exit the goroutine if the channel is closed
 		}
 		// Process incoming messages for the room here
+		r.touch()
 		fmt.Printf("Processing  %s message for room %s\n", msg.Header.Protocol, r.Id)
 		fmt.Printf("Msgs waiting in rooms msg channel: %v\n", len(r.IncomingMsgs))
 
+		if msg.Hiker == nil {
+			// Queued by the room's own timers, see enqueue
+			r.handleServerMessage(msg)
+			continue
+		}
+		if msg.Hiker.IsSpectator && msg.Hiker.roomId() == r.Id && !spectatorAllowed(msg.Header.Protocol) {
+			r.sendError(msg.Hiker, "Spectators cannot "+msg.Header.Protocol)
+			continue
+		}
+		if !waitlistAllowed(msg.Header.Protocol) && r.isWaitlisted(msg.Hiker) {
+			r.sendError(msg.Hiker, "You are on the waitlist and cannot "+msg.Header.Protocol)
+			continue
+		}
+
 		switch msg.Header.Protocol {
 		case "create":
+			//Start from the chosen preset, if any
+			if preset := msg.stringField("preset"); preset != "" {
+				if err := r.applyPreset(preset); err != nil {
+					r.sendError(msg.Hiker, err.Error())
+				}
+			}
 			//Create new room
-			err := r.create_protocol(msg.Hiker)
+			err := r.create_protocol(msg.Hiker, msg.Message["roomConfig"])
 			if err != nil {
 				fmt.Printf("Error in create protocol: %v", err)
 			}
+			r.syncSchedule()
 		case "join":
+			//watch the room instead of hiking
+			if msg.boolField("spectator") {
+				err := r.spectate_protocol(msg.Hiker)
+				if err != nil {
+					fmt.Printf("Error in spectate protocol: %v", err)
+				}
+				break
+			}
 			//join new room
 			err := r.join_protocol(msg.Hiker)
 			if err != nil {
 				fmt.Printf("Error in join protocol: %v", err)
 			}
+			r.checkReady()
 		case "ready":
 			//ready status for the hikers
 			err := r.ready_protocol(msg.Hiker)
 			if err != nil {
 				fmt.Printf("Error in ready protocol: %v", err)
 			}
+			r.checkReady()
 		case "updateConfig":
 			//get timer config from msg.message.timerConfig
 			timerConfig := msg.Message["timerConfig"]
@@ -60,10 +158,18 @@ func (r *Room) handleRoomMessages() {
 			//get session config from msg.message.sessionConfig
 			sessionConfig := msg.Message["sessionConfig"]
 
-			err := r.updateConfig_protocol(msg.Hiker, timerConfig, sessionConfig)
+			//get room config from msg.message.roomConfig
+			roomConfig := msg.Message["roomConfig"]
+
+			err := r.updateConfig_protocol(msg.Hiker, msg.stringField("preset"), timerConfig, sessionConfig, roomConfig)
 			if err != nil {
 				fmt.Printf("Error in updateTimerConfig protocol: %v", err)
 			}
+			// A raised capacity may free spots for waiting hikers
+			r.admitFromWaitlist()
+			r.syncSchedule()
+			r.checkReady()
+			r.persist()
 			// send ready responses
 			err = r.responseFactory("updateConfig", msg.Hiker)
 			if err != nil {
@@ -71,7 +177,16 @@ func (r *Room) handleRoomMessages() {
 
 			}
 		case "start":
-			r.start_protocol()
+			//the host or a co-host can force a start past the ready policy
+			if err := r.canStart(msg.Hiker, msg.boolField("force")); err != nil {
+				r.sendError(msg.Hiker, err.Error())
+				fmt.Printf("Error in start protocol: %v", err)
+				break
+			}
+			if err := r.start_protocol(msg.Hiker); err != nil {
+				fmt.Printf("Error in start protocol: %v", err)
+				break
+			}
 
 			err := r.responseFactory("start", msg.Hiker)
 			if err != nil {
@@ -95,15 +210,29 @@ func (r *Room) handleRoomMessages() {
 			if err != nil {
 				log.Printf("error in resume_protocol: %v", err)
 			}
+		case "pauseRoom":
+			err := r.pauseRoom_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in pauseRoom protocol: %v", err)
+			}
+		case "resumeRoom":
+			err := r.resumeRoom_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in resumeRoom protocol: %v", err)
+			}
 		case "leave":
 			err := r.leave_protocol(msg.Hiker)
 			if err != nil {
 				fmt.Printf("Error in leave protocol: %v", err)
 			}
+			if !r.isClosed() {
+				r.checkReady()
+			}
 		case "end":
 			err := r.end_protocol(msg.Hiker)
 			if err != nil {
 				fmt.Printf("Error in end protocol: %v", err)
+				break
 			}
 			err = r.responseFactory("end", msg.Hiker)
 			if err != nil {
@@ -111,9 +240,10 @@ func (r *Room) handleRoomMessages() {
 			}
 		case "extraSet":
 
-			err := r.extraSet_protocol()
+			err := r.extraSet_protocol(msg.Hiker)
 			if err != nil {
 				fmt.Printf("Error in extraSet protocol: %v", err)
+				break
 			}
 
 			err = r.responseFactory("extraSet", msg.Hiker)
@@ -122,22 +252,199 @@ func (r *Room) handleRoomMessages() {
 			}
 		case "extraSession":
 
-			err := r.extraSession_protocol()
+			err := r.extraSession_protocol(msg.Hiker)
 			if err != nil {
 				fmt.Printf("Error in extraSession protocol: %v", err)
+				break
 			}
 
 			err = r.responseFactory("extraSession", msg.Hiker)
 			if err != nil {
 				log.Printf("error in extraSession_protocol: %v", err)
 			}
+		case "cancelSchedule":
+			err := r.cancelSchedule_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in cancelSchedule protocol: %v", err)
+			}
+		case "overtime":
+			err := r.overtime_protocol(msg.Hiker, msg.boolField("enabled"))
+			if err != nil {
+				fmt.Printf("Error in overtime protocol: %v", err)
+			}
+		case "stopFocus":
+			err := r.stopFocus_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in stopFocus protocol: %v", err)
+			}
+		case "adjustTime":
+			err := r.adjustTime_protocol(msg.Hiker, msg.intField("seconds"))
+			if err != nil {
+				fmt.Printf("Error in adjustTime protocol: %v", err)
+			}
+		case "editIntervals":
+			err := r.editIntervals_protocol(msg.Hiker, msg.stringField("op"), msg.intField("index"), msg.intField("count"), msg.intField("to"), msg.Message["intervals"])
+			if err != nil {
+				fmt.Printf("Error in editIntervals protocol: %v", err)
+			}
+		case "skipBreak":
+			err := r.skipBreak_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in skipBreak protocol: %v", err)
+				break
+			}
+			err = r.responseFactory("skipBreak", msg.Hiker)
+			if err != nil {
+				log.Printf("error in skipBreak_protocol: %v", err)
+			}
+		case "saveDefaults":
+			err := r.saveDefaults_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in saveDefaults protocol: %v", err)
+			}
+		case "deleteRoom":
+			err := r.deleteRoom_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in deleteRoom protocol: %v", err)
+			}
+		case "transferHost":
+			err := r.transferHost_protocol(msg.Hiker, msg.stringField("userId"))
+			if err != nil {
+				fmt.Printf("Error in transferHost protocol: %v", err)
+			}
+		case "addCoHost", "removeCoHost":
+			err := r.coHost_protocol(msg.Hiker, msg.stringField("userId"), msg.Header.Protocol == "addCoHost")
+			if err != nil {
+				fmt.Printf("Error in %s protocol: %v", msg.Header.Protocol, err)
+			}
+		case "kick":
+			err := r.kick_protocol(msg.Hiker, msg.stringField("userId"))
+			if err != nil {
+				fmt.Printf("Error in kick protocol: %v", err)
+			}
+		case "ban":
+			err := r.ban_protocol(msg.Hiker, msg.stringField("userId"), msg.stringField("reason"), msg.boolField("banIp"))
+			if err != nil {
+				fmt.Printf("Error in ban protocol: %v", err)
+			}
+		case "unban":
+			err := r.unban_protocol(msg.Hiker, msg.stringField("userId"))
+			if err != nil {
+				fmt.Printf("Error in unban protocol: %v", err)
+			}
+		case "listBans":
+			err := r.listBans_protocol(msg.Hiker)
+			if err != nil {
+				fmt.Printf("Error in listBans protocol: %v", err)
+			}
 		default:
 			fmt.Printf("Received unknown protocol %s in room %s\n", msg.Header.Protocol, r.Id)
 
 		}
+		r.publishLobby()
+	}
+}
+
+// enqueue hands a message from the server itself to the room goroutine, so
+// timers firing on the clock's goroutine change the room in turn with its
+// hikers' messages. Messages for a closed or backed up room are dropped.
+func (r *Room) enqueue(protocol string, message map[string]interface{}) {
+	r.sendMux.RLock()
+	defer r.sendMux.RUnlock()
+	if r.isClosed() {
+		return
+	}
+	select {
+	case r.IncomingMsgs <- &ClientPacket{Header: Header{Protocol: protocol, RoomId: r.Id}, Message: message}:
+	default:
+		fmt.Printf("Dropped %s for room %s, its queue is full\n", protocol, r.Id)
+	}
+}
+
+// deliver hands a client's message to the room goroutine, waiting while the
+// queue is full. It reports false when the room has closed.
+func (r *Room) deliver(msg *ClientPacket) bool {
+	r.sendMux.RLock()
+	defer r.sendMux.RUnlock()
+	if r.isClosed() {
+		return false
+	}
+	select {
+	case r.IncomingMsgs <- msg:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// handleServerMessage runs a message queued with enqueue.
+func (r *Room) handleServerMessage(msg *ClientPacket) {
+	switch msg.Header.Protocol {
+	case "startScheduled":
+		at, _ := msg.Message["at"].(time.Time)
+		r.startScheduled(at)
+	case "startReminder":
+		at, _ := msg.Message["at"].(time.Time)
+		startsIn, _ := msg.Message["startsIn"].(time.Duration)
+		r.remindStart(at, startsIn)
+	case "autoStart":
+		at, _ := msg.Message["at"].(time.Time)
+		r.autoStart(at)
+	case "decisionExpired":
+		deadline, _ := msg.Message["deadline"].(time.Time)
+		r.decisionExpired(deadline)
+	case "timeWarning":
+		phase, _ := msg.Message["phase"].(Phase)
+		left, _ := msg.Message["left"].(time.Duration)
+		armed, _ := msg.Message["armed"].(uint64)
+		r.timeWarning(phase, left, armed)
+	case "hostGraceExpired":
+		at, _ := msg.Message["at"].(time.Time)
+		hostId, _ := msg.Message["hostId"].(string)
+		r.hostGraceExpired(at, hostId)
+	default:
+		fmt.Printf("Received unknown server protocol %s in room %s\n", msg.Header.Protocol, r.Id)
 	}
 }
 
+// close stops the room from taking messages and takes it out of the lobby.
+// It is safe to call more than once.
+func (r *Room) close() {
+	r.closeOnce.Do(func() {
+		// Spectators can't keep an empty room open, let them know it is gone
+		for _, spectator := range r.spectatorsSnapshot() {
+			packet, _ := r.packMessage("roomClosed", map[string]interface{}{
+				"type":    "direct",
+				"message": "The room has closed",
+			}, spectator)
+			select {
+			case spectator.MsgCh <- packet:
+			default:
+			}
+			spectator.setRoomId("")
+			spectator.IsSpectator = false
+		}
+		r.cancelHostGrace()
+		r.scheduleMux.Lock()
+		r.stopScheduleTimers()
+		r.scheduleMux.Unlock()
+		r.cancelAutoStart()
+		r.cancelDecision()
+		r.publishLobbyClosed()
+		r.lobbyMux.Lock()
+		r.closed = true
+		r.lobbyMux.Unlock()
+		if r.done != nil {
+			close(r.done)
+		}
+		r.sendMux.Lock()
+		if r.IncomingMsgs != nil {
+			close(r.IncomingMsgs)
+		}
+		r.sendMux.Unlock()
+	})
+}
+
 // SendMessage sends the encoded message to the specified hiker.
 func (r *Room) sendMessage(h *Client, packet ServerPacket) {
 	// Send message to hikers msg channel
@@ -145,6 +452,31 @@ func (r *Room) sendMessage(h *Client, packet ServerPacket) {
 
 }
 
+// sendError sends an Error packet with message directly to h, if there is one.
+func (r *Room) sendError(h *Client, message string) {
+	if h == nil {
+		return
+	}
+	packet, _ := r.packMessage("Error", map[string]interface{}{
+		"type":    "direct",
+		"status":  "error",
+		"message": message,
+	}, h)
+	r.sendMessage(h, packet)
+}
+
+func (r *Room) clock() Clock {
+	if r.Clock == nil {
+		return RealClock{}
+	}
+	return r.Clock
+}
+
+// isHost reports whether h is the room's host.
+func (r *Room) isHost(h *Client) bool {
+	return h != nil && h.Id == r.Host
+}
+
 // Takes a &Message{protocol: "", Message: interface{}}
 func (r *Room) responseFactory(protocol string, hiker *Client) error {
 
@@ -155,6 +487,7 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 		hikersSnapshot[k] = v
 	}
 	r.HikersMux.RUnlock()
+	spectatorsSnapshot := r.spectatorsSnapshot()
 
 	r.Session.SessionMux.RLock()
 	sessionSnapshot := r.Session
@@ -166,9 +499,10 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 	switch protocol {
 	case "create":
 		directMessage := map[string]interface{}{
-			"status":  "success",
-			"message": "",
-			"hikers":  hikersSnapshot,
+			"status":   "success",
+			"message":  "",
+			"username": hiker.Username,
+			"hikers":   hikersSnapshot,
 		}
 		packet, err := r.packMessage("create", directMessage, hiker)
 		if err != nil {
@@ -180,12 +514,20 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 	case "join":
 		// Direct message to the joining hiker
 		directMessage := map[string]interface{}{
-			"type":    "direct",
-			"status":  "success",
-			"message": "",
-			"hikers":  hikersSnapshot,
-			"session": sessionSnapshot,
-			"timer":   timerSnapshot,
+			"type":       "direct",
+			"status":     "success",
+			"message":    "",
+			"username":   hiker.Username, // Final display name after normalization and collision handling
+			"hikers":     hikersSnapshot,
+			"spectators": spectatorsSnapshot,
+			"session":    sessionSnapshot,
+			"timer":      timerSnapshot,
+
+			"scheduledStart": r.scheduledStart(),
+		}
+		if r.Persistent {
+			directMessage["slug"] = r.Slug
+			directMessage["members"] = r.record().Members
 		}
 		packet, err := r.packMessage("join", directMessage, hiker)
 		if err != nil {
@@ -195,12 +537,39 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 
 		// Broadcast to all other hikers
 		broadcastMessage := map[string]interface{}{
-			"type":    "broadcast",
-			"message": hiker.Username + " has joined the room",
-			"hikers":  hikersSnapshot,
+			"type":       "broadcast",
+			"message":    hiker.Username + " has joined the room",
+			"hikers":     hikersSnapshot,
+			"spectators": spectatorsSnapshot,
 		}
 		return r.broadcastExcept("join", broadcastMessage, hiker)
 
+	case "spectate":
+		directMessage := map[string]interface{}{
+			"type":       "direct",
+			"status":     "success",
+			"message":    "",
+			"role":       "spectator",
+			"username":   hiker.Username,
+			"hikers":     hikersSnapshot,
+			"spectators": spectatorsSnapshot,
+			"session":    sessionSnapshot,
+			"timer":      timerSnapshot,
+		}
+		packet, err := r.packMessage("spectate", directMessage, hiker)
+		if err != nil {
+			return fmt.Errorf("Error in responseFactory: %v", err)
+		}
+		r.sendMessage(hiker, packet)
+
+		broadcastMessage := map[string]interface{}{
+			"type":       "broadcast",
+			"message":    hiker.Username + " is watching",
+			"hikers":     hikersSnapshot,
+			"spectators": spectatorsSnapshot,
+		}
+		return r.broadcastExcept("spectate", broadcastMessage, hiker)
+
 	case "kicked":
 		broadcastMessage := map[string]interface{}{
 			"type":    "broadcast",
@@ -209,6 +578,14 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 		}
 		r.broadcast("kicked", broadcastMessage)
 
+	case "banned":
+		broadcastMessage := map[string]interface{}{
+			"type":    "broadcast",
+			"message": hiker.Username + " has been banned from the room",
+			"hikers":  hikersSnapshot,
+		}
+		return r.broadcast("banned", broadcastMessage)
+
 	case "ready":
 		directMessage := map[string]interface{}{
 			"type":    "direct",
@@ -267,15 +644,13 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 	case "update":
 		//send New hikers, session and timer states to hikers
 
-		remainingTime := r.Timer.RemainingTime()
-
-		message := map[string]interface{}{
-			"type":          "broadcast",
-			"hikers":        hikersSnapshot,
-			"timer":         timerSnapshot,
-			"session":       sessionSnapshot,
-			"remainingTime": remainingTime.Seconds(), // Send remaining time in seconds
-		}
+		message := r.Timer.addPhaseTime(map[string]interface{}{
+			"type":       "broadcast",
+			"hikers":     hikersSnapshot,
+			"spectators": spectatorsSnapshot,
+			"timer":      timerSnapshot,
+			"session":    sessionSnapshot,
+		})
 		return r.broadcast("update", message)
 	case "pause":
 
@@ -307,23 +682,20 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 	case "resume":
 		// resume message
 
-		remainingTime := r.Timer.RemainingTime()
 		message := fmt.Sprintf("Hiker %s has resumed", hiker.Username)
-		err := r.broadcastExcept("resume", map[string]interface{}{
+		err := r.broadcastExcept("resume", r.Timer.addPhaseTime(map[string]interface{}{
 			"resumeHikerId": hiker.Id,
-			"remainingTime": remainingTime.Seconds(),
 			"message":       message,
-		}, hiker)
+		}), hiker)
 		if err != nil {
 			return fmt.Errorf("Error in responseFactory: %v", err)
 		}
 
-		directMessage := map[string]interface{}{
-			"type":          "direct",
-			"status":        "success",
-			"message":       "",
-			"remainingTime": remainingTime.Seconds(),
-		}
+		directMessage := r.Timer.addPhaseTime(map[string]interface{}{
+			"type":    "direct",
+			"status":  "success",
+			"message": "",
+		})
 		packet, err := r.packMessage("resume", directMessage, hiker)
 		if err != nil {
 			fmt.Printf("Error in responseFactory: %v", err)
@@ -359,9 +731,10 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 	case "leave":
 		message := fmt.Sprintf("Hiker %s has left", hiker.Username)
 		return r.broadcastExcept("leave", map[string]interface{}{
-			"type":    "broadcast",
-			"message": message,
-			"hikers":  hikersSnapshot,
+			"type":       "broadcast",
+			"message":    message,
+			"hikers":     hikersSnapshot,
+			"spectators": spectatorsSnapshot,
 		}, hiker)
 	default:
 		return fmt.Errorf("unknown protocol: %s", protocol)
@@ -371,15 +744,15 @@ func (r *Room) responseFactory(protocol string, hiker *Client) error {
 
 }
 func (r *Room) broadcastExcept(protocol string, message map[string]interface{}, h *Client) error {
-	r.HikersMux.RLock() // Lock for reading
-	defer r.HikersMux.RUnlock()
-	fmt.Printf("Total hikers in room: %d\n", len(r.Hikers))
+	// Snapshot under the read lock so a slow hiker can be kicked while sending
+	recipients := r.recipients()
+	fmt.Printf("Total hikers in room: %d\n", len(recipients))
 	fmt.Printf("Attempting broadcast except %v\n", h.Username)
-	for id, hiker := range r.Hikers {
+	for _, hiker := range recipients {
 
-		// Send message to all hikers
+		// Send message to all hikers and spectators
 		// Do not send message to sender
-		if id == h.Id {
+		if hiker.Id == h.Id {
 			fmt.Printf("Skipping broadcast to %v\n", hiker.Username)
 			continue
 		}
@@ -393,7 +766,7 @@ func (r *Room) broadcastExcept(protocol string, message map[string]interface{},
 		select {
 		case hiker.MsgCh <- packet:
 			fmt.Printf("Broadcast Sent to %v\n", hiker.Username)
-		case <-time.After(100 * time.Millisecond):
+		case <-r.clock().After(100 * time.Millisecond):
 			r.warnOrRemoveHiker(hiker)
 			fmt.Printf("Message dropped for %v\n", hiker.Username)
 		}
@@ -403,8 +776,7 @@ func (r *Room) broadcastExcept(protocol string, message map[string]interface{},
 }
 
 func (r *Room) broadcast(protocol string, message map[string]interface{}) error {
-
-	for _, hiker := range r.Hikers {
+	for _, hiker := range r.recipients() {
 		packet, err := r.packMessage(protocol, message, hiker)
 		if err != nil {
 			return fmt.Errorf("Error in broadcast: %v", err)
@@ -412,7 +784,7 @@ func (r *Room) broadcast(protocol string, message map[string]interface{}) error
 		select {
 		case hiker.MsgCh <- packet:
 			fmt.Printf("Broadcast Sent to %v\n", hiker.Username)
-		case <-time.After(100 * time.Millisecond):
+		case <-r.clock().After(100 * time.Millisecond):
 			r.warnOrRemoveHiker(hiker)
 			fmt.Printf("Message dropped for %v\n", hiker.Username)
 		}
@@ -438,22 +810,49 @@ func (r *Room) packMessage(protocol string, message map[string]interface{}, h *C
 func (r *Room) warnOrRemoveHiker(hiker *Client) {
 	hiker.droppedMessages++
 	if hiker.droppedMessages >= 3 {
-		r.kickHiker(hiker)
+		r.audit(nil, "kick", map[string]interface{}{
+			"userId":   hiker.Id,
+			"username": hiker.Username,
+			"reason":   "slow connection",
+		})
+		r.kickHiker(hiker, "kicked", "Removed due to inactivity or slow connection")
 		log.Printf("kicked hiker %s due to inactivity or slow connection\n", hiker.Id)
 	}
 }
 
 func (r *Room) AddHiker(h *Client) error {
-
+	// Settle the distance so far, a newcomer only accrues from here
+	r.accrue()
 	r.HikersMux.Lock()
 	defer r.HikersMux.Unlock()
 	fmt.Println("in AddHiker")
 	_, ok := r.Hikers[h.Id]
 	if !ok {
+		if capacity := r.capacity(); capacity > 0 && len(r.Hikers) >= capacity {
+			return errRoomFull
+		}
+		h.IsSpectator = false
+		h.JoinedAt = r.clock().Now()
+		h.IsCoHost = r.CoHosts[h.Id]
+		if h.Id == r.Host {
+			// The host reconnected within its grace period
+			h.IsHost = true
+			r.cancelHostGrace()
+		}
+		if r.Host == "" {
+			// First hiker into an emptied persistent room
+			r.Host = h.Id
+			h.IsHost = true
+		}
+		username, err := r.uniqueUsername(h, h.Username)
+		if err != nil {
+			return err
+		}
+		h.Username = username
 		fmt.Println("setting hiker in room")
 		r.Hikers[h.Id] = h
 		fmt.Println("making hiker room Id")
-		h.RoomId = r.Id
+		h.setRoomId(r.Id)
 		fmt.Printf("Hiker %s added to room %s. Total hikers: %d\n", h.Username, r.Id, len(r.Hikers))
 		r.Timer.TimerMux.RLock()
 		defer r.Timer.TimerMux.RUnlock()
@@ -468,60 +867,118 @@ func (r *Room) AddHiker(h *Client) error {
 
 }
 
+// RemoveHiker drops a disconnected client from the room. A disconnected host
+// keeps the role for HostGracePeriod so it can reconnect.
 func (r *Room) RemoveHiker(h *Client) string {
+	return r.dropHiker(h, r.HostGracePeriod)
+}
+
+// dropHiker removes h from the waitlist, spectators or hikers. If h is the
+// host a successor is elected after hostGrace.
+func (r *Room) dropHiker(h *Client, hostGrace time.Duration) string {
+	if r.removeFromWaitlist(h) {
+		fmt.Printf("Hiker %s left the waitlist of room %s\n", h.Username, r.Id)
+		r.sendWaitlistPositions()
+		return "left waitlist"
+	}
+	if r.removeSpectator(h) {
+		fmt.Printf("Spectator %s left room %s\n", h.Username, r.Id)
+		h.IsSpectator = false
+		r.responseFactory("leave", h)
+		return "left spectators"
+	}
+
+	// Settle the distance h covered before it leaves
+	r.accrue()
 	r.HikersMux.Lock()
-	defer r.HikersMux.Unlock()
 	delete(r.Hikers, h.Id)
-	fmt.Printf("Hiker %s removed from room %s. Total hikers: %d\n", h.Username, r.Id, len(r.Hikers))
-	if len(r.Hikers) == 0 {
-		close(r.IncomingMsgs)
+	r.HikersMux.Unlock()
+
+	// Fill the free spot before deciding whether the room is empty
+	r.admitFromWaitlist()
+
+	r.HikersMux.RLock()
+	remaining := len(r.Hikers)
+	r.HikersMux.RUnlock()
+	fmt.Printf("Hiker %s removed from room %s. Total hikers: %d\n", h.Username, r.Id, remaining)
+	if remaining == 0 && r.Persistent {
+		r.resetForNextSession()
+		r.publishLobby()
+		return "room emptied"
+	}
+	if remaining == 0 {
+		r.close()
 		return "close room"
-	} else {
+	}
+	defer r.publishLobby()
+	if r.Host == h.Id {
+		if hostGrace > 0 {
+			r.startHostGrace(h)
+			return "host grace"
+		}
 		r.setNewHost()
 		return "set new host"
 	}
+	return "removed"
 
 }
 
+// setNewHost elects a successor to the host, see nextHost.
 func (r *Room) setNewHost() error {
-	var newHost *Client
-	for _, hiker := range r.Hikers {
-		newHost = hiker
-		hiker.IsHost = true
-		r.Host = hiker.Id
-		fmt.Printf("Hiker %s is the new host\n", newHost.Username)
-		break
-	}
-	hikersSnapshot := make(map[string]*Client, len(r.Hikers))
-	for k, v := range r.Hikers {
-		hikersSnapshot[k] = v
-	}
-
-	fmt.Printf("New Host is: %s\n", newHost.Username)
-	message := map[string]interface{}{
-		"type":    "broadcast",
-		"hikers":  hikersSnapshot,
-		"message": fmt.Sprintf("%s is the new host", newHost.Username),
+	r.HikersMux.RLock()
+	newHost := r.nextHost()
+	r.HikersMux.RUnlock()
+	if newHost == nil {
+		return nil
 	}
-
-	return r.broadcast("newHost", message)
-
+	return r.assignHost(newHost, nil)
 }
 
-func (r *Room) kickHiker(h *Client) error {
-	close(h.MsgCh)         //Close hikers msg channel
+// kickHiker removes h from the room, sends it a direct notice under protocol
+// and closes its connection once the notice is written. The remaining hikers
+// receive the matching broadcast.
+func (r *Room) kickHiker(h *Client, protocol string, reason string) error {
+	r.accrue()
+	r.HikersMux.Lock()
 	delete(r.Hikers, h.Id) //Remove from room
+	delete(r.Spectators, h.Id)
+	remaining := len(r.Hikers)
+	r.HikersMux.Unlock()
+
+	wasHost := h.IsHost
+	h.IsHost = false
+	h.setRoomId("") // Keep removeClient from removing the hiker a second time
+
+	notice, _ := r.packMessage(protocol, map[string]interface{}{
+		"type":    "direct",
+		"message": reason,
+	}, h)
+	h.disconnect(notice)
+
+	// Fill the free spot before deciding whether the room is empty
+	r.admitFromWaitlist()
+	r.HikersMux.RLock()
+	remaining = len(r.Hikers)
+	r.HikersMux.RUnlock()
 
-	if len(r.Hikers) == 0 {
-		close(r.IncomingMsgs)
-	} else {
+	if remaining == 0 && r.Persistent {
+		r.resetForNextSession()
+		r.publishLobby()
+		return nil
+	}
+	if remaining == 0 {
+		r.close()
+		return nil
+	}
+	defer r.publishLobby()
+	if wasHost {
 		err := r.setNewHost()
 		if err != nil {
 			return fmt.Errorf("error in kickHiker: %v\n", err)
 		}
 	}
 
-	err := r.responseFactory("kicked", h) //Broadcast kicked message
+	err := r.responseFactory(protocol, h) //Broadcast kicked message
 	if err != nil {
 		return fmt.Errorf("error in kickHiker: %v\n", err)
 	}
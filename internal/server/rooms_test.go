@@ -0,0 +1,211 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestRoom builds a room without a running server. The first hiker is host.
+func newTestRoom(hikers ...*Client) *Room {
+	room := &Room{
+		Id:           "room1",
+		Hikers:       make(map[string]*Client),
+		Session:      &Session{Level: 1},
+		Timer:        &Timer{FocusTime: 1500, ShortBreakTime: 300, LongBreakTime: 900, Sets: 3, Pace: 2.0},
+		IncomingMsgs: make(chan *ClientPacket, 16),
+		done:         make(chan struct{}),
+		Bans:         make(map[string]*Ban),
+	}
+	for i, h := range hikers {
+		if i == 0 {
+			room.Host = h.Id
+			h.IsHost = true
+		}
+		room.Hikers[h.Id] = h
+		h.RoomId = room.Id
+	}
+	return room
+}
+
+// newClockedRoom is newTestRoom on a FakeClock. Every hiker has room for a
+// whole session of broadcasts, and the timer stops when the test ends.
+func newClockedRoom(t *testing.T, hikers ...*Client) (*Room, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	for _, h := range hikers {
+		h.MsgCh = make(chan ServerPacket, 4096)
+	}
+	room := newTestRoom(hikers...)
+	room.Clock = clock
+	room.Timer.Clock = clock
+	t.Cleanup(room.Timer.Stop)
+	return room, clock
+}
+
+// serveRoom runs the room goroutine until the test ends, for timers that queue
+// their work with enqueue.
+func serveRoom(t *testing.T, room *Room) {
+	go room.handleRoomMessages()
+	t.Cleanup(room.close)
+}
+
+// runQueued runs the work timers queued with enqueue on the test goroutine,
+// after a FakeClock Advance.
+func runQueued(room *Room) {
+	for {
+		select {
+		case msg := <-room.IncomingMsgs:
+			room.handleServerMessage(msg)
+		default:
+			return
+		}
+	}
+}
+
+func newTestHiker(id string) *Client {
+	return &Client{Id: id, Username: "hiker" + id, MsgCh: make(chan ServerPacket, 64)}
+}
+
+// lastPacket drains h's message channel and returns the final packet.
+func lastPacket(t *testing.T, h *Client) ServerPacket {
+	t.Helper()
+	var packet ServerPacket
+	found := false
+	for {
+		select {
+		case packet = <-h.MsgCh:
+			found = true
+		default:
+			if !found {
+				t.Fatalf("no packet sent to %s", h.Username)
+			}
+			return packet
+		}
+	}
+}
+
+func TestBanPreventsRejoin(t *testing.T) {
+	host := newTestHiker("1")
+	target := newTestHiker("2")
+	target.Ip = "10.0.0.2"
+	room := newTestRoom(host, target)
+
+	if err := room.ban_protocol(host, target.Id, "spam", true); err != nil {
+		t.Fatalf("ban failed: %v", err)
+	}
+
+	notice := <-target.MsgCh
+	if notice.Header.Protocol != "banned" || !notice.closeConn {
+		t.Fatalf("expected closing banned notice, got %+v", notice)
+	}
+	if _, ok := room.Hikers[target.Id]; ok {
+		t.Fatal("banned hiker still in room")
+	}
+
+	// Same IP under a new user id is still banned
+	returning := newTestHiker("3")
+	returning.Ip = "10.0.0.2"
+	if err := room.join_protocol(returning); err == nil {
+		t.Fatal("expected join from banned IP to fail")
+	}
+	if packet := lastPacket(t, returning); packet.Header.Protocol != "Error" {
+		t.Fatalf("expected Error packet, got %s", packet.Header.Protocol)
+	}
+
+	if err := room.unban_protocol(host, target.Id); err != nil {
+		t.Fatalf("unban failed: %v", err)
+	}
+	if err := room.join_protocol(returning); err != nil {
+		t.Fatalf("expected join after unban to succeed: %v", err)
+	}
+}
+
+func TestKickRequiresHost(t *testing.T) {
+	host := newTestHiker("1")
+	other := newTestHiker("2")
+	room := newTestRoom(host, other)
+
+	if err := room.kick_protocol(other, host.Id); err == nil {
+		t.Fatal("expected non-host kick to fail")
+	}
+	if _, ok := room.Hikers[host.Id]; !ok {
+		t.Fatal("host was removed by a non-host kick")
+	}
+
+	if err := room.kick_protocol(host, other.Id); err != nil {
+		t.Fatalf("kick failed: %v", err)
+	}
+	if _, ok := room.Hikers[other.Id]; ok {
+		t.Fatal("kicked hiker still in room")
+	}
+	if room.isBanned(other) {
+		t.Fatal("kick should not ban")
+	}
+	if other.roomId() != "" {
+		t.Fatalf("kicked hiker still points at room %q", other.roomId())
+	}
+}
+
+func TestKickRacesDisconnect(t *testing.T) {
+	host, other := newTestHiker("1"), newTestHiker("2")
+	room := newTestRoom(host, other)
+
+	// removeClient on the read loop takes the room id while the room kicks
+	taken := make(chan string)
+	go func() { taken <- other.takeRoomId() }()
+	if err := room.kick_protocol(host, other.Id); err != nil {
+		t.Fatalf("kick failed: %v", err)
+	}
+	if id := <-taken; id != "" && id != room.Id {
+		t.Fatalf("unexpected room id %q", id)
+	}
+	if other.roomId() != "" {
+		t.Fatalf("expected no room id after the kick, got %q", other.roomId())
+	}
+}
+
+func TestRejectedUpdateConfigChangesNothing(t *testing.T) {
+	host := newTestHiker("1")
+	room := newTestRoom(host)
+	room.Session.Name = "Morning"
+
+	err := room.updateConfig_protocol(host, "",
+		map[string]interface{}{"focusTime": 60},
+		map[string]interface{}{"name": "Evening"},
+		map[string]interface{}{"name": "changed", "decisionDefault": "bogus"})
+	if err == nil {
+		t.Fatal("expected an unknown decisionDefault to fail")
+	}
+	if room.Timer.FocusTime != 1500 || room.Session.Name != "Morning" || room.Config.Name != "" {
+		t.Fatalf("a rejected update was applied: focusTime %d, session %q, room %q", room.Timer.FocusTime, room.Session.Name, room.Config.Name)
+	}
+
+	err = room.updateConfig_protocol(host, "No such preset", nil, map[string]interface{}{"name": "Evening"}, nil)
+	if err == nil || room.Session.Name != "Morning" {
+		t.Fatalf("expected an unknown preset to change nothing, got %v and session %q", err, room.Session.Name)
+	}
+}
+
+func TestUpdateConfigRequiresHost(t *testing.T) {
+	host, hiker := newTestHiker("1"), newTestHiker("2")
+	room := newTestRoom(host, hiker)
+
+	err := room.updateConfig_protocol(hiker, "", map[string]interface{}{"focusTime": 60}, nil, map[string]interface{}{"maxHikers": 2})
+	if err == nil {
+		t.Fatal("expected a hiker's updateConfig to be rejected")
+	}
+	if room.Timer.FocusTime != 1500 || room.Config.MaxHikers != 0 {
+		t.Fatalf("a hiker changed the settings: focusTime %d, maxHikers %d", room.Timer.FocusTime, room.Config.MaxHikers)
+	}
+	if packet := lastPacket(t, hiker); packet.Header.Protocol != "Error" {
+		t.Fatalf("expected an error for the hiker, got %s", packet.Header.Protocol)
+	}
+
+	room.CoHosts = map[string]bool{hiker.Id: true}
+	if err := room.updateConfig_protocol(hiker, "", nil, nil, map[string]interface{}{"maxHikers": 2}); err != nil {
+		t.Fatalf("co-host updateConfig failed: %v", err)
+	}
+	if room.Config.MaxHikers != 2 {
+		t.Fatalf("expected a co-host to set maxHikers, got %d", room.Config.MaxHikers)
+	}
+}
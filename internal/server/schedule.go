@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultStartReminders are how long before a scheduled start the room is reminded.
+var DefaultStartReminders = []time.Duration{15 * time.Minute, 5 * time.Minute, time.Minute}
+
+// scheduledStart returns the room's pending scheduled start, nil when there is none.
+func (r *Room) scheduledStart() *time.Time {
+	r.ConfigMux.RLock()
+	defer r.ConfigMux.RUnlock()
+	if r.Config.ScheduledStart == nil {
+		return nil
+	}
+	at := *r.Config.ScheduledStart
+	return &at
+}
+
+// syncSchedule arms the reminders and auto start for the room's scheduled
+// start, replacing any earlier schedule, and tells the room when it changed.
+func (r *Room) syncSchedule() {
+	at := r.scheduledStart()
+
+	r.scheduleMux.Lock()
+	if (at == nil && r.scheduledFor.IsZero()) || (at != nil && at.Equal(r.scheduledFor)) {
+		r.scheduleMux.Unlock()
+		return
+	}
+	rescheduled := !r.scheduledFor.IsZero()
+	r.stopScheduleTimers()
+	if at != nil {
+		r.armSchedule(*at)
+	}
+	r.scheduleMux.Unlock()
+
+	var event, message string
+	switch {
+	case at == nil:
+		event = "cancelled"
+		message = "The scheduled session was cancelled"
+	case rescheduled:
+		event = "rescheduled"
+		message = "Session moved to " + at.Format(time.RFC3339)
+	default:
+		event = "scheduled"
+		message = "Session starts at " + at.Format(time.RFC3339)
+	}
+	r.broadcast("schedule", map[string]interface{}{
+		"type":           "broadcast",
+		"event":          event,
+		"scheduledStart": at,
+		"message":        message,
+	})
+}
+
+// armSchedule sets a reminder for each of the room's StartReminders still
+// ahead of at, and the auto start itself. Both are queued to the room
+// goroutine when they fire. The caller must hold scheduleMux.
+func (r *Room) armSchedule(at time.Time) {
+	r.scheduledFor = at
+	now := r.clock().Now()
+	for _, offset := range r.StartReminders {
+		remindAt := at.Add(-offset)
+		if !remindAt.After(now) {
+			continue
+		}
+		startsIn := offset
+		r.scheduleTimers = append(r.scheduleTimers, r.clock().AfterFunc(remindAt.Sub(now), func() {
+			r.enqueue("startReminder", map[string]interface{}{"at": at, "startsIn": startsIn})
+		}))
+	}
+	r.scheduleTimers = append(r.scheduleTimers, r.clock().AfterFunc(at.Sub(now), func() {
+		r.enqueue("startScheduled", map[string]interface{}{"at": at})
+	}))
+}
+
+// stopScheduleTimers cancels pending reminders and the auto start. The caller
+// must hold scheduleMux.
+func (r *Room) stopScheduleTimers() {
+	for _, timer := range r.scheduleTimers {
+		timer.Stop()
+	}
+	r.scheduleTimers = nil
+	r.scheduledFor = time.Time{}
+}
+
+// cancelSchedule drops the scheduled start without telling the room.
+func (r *Room) cancelSchedule() {
+	r.scheduleMux.Lock()
+	r.stopScheduleTimers()
+	r.scheduleMux.Unlock()
+
+	r.ConfigMux.Lock()
+	r.Config.ScheduledStart = nil
+	r.ConfigMux.Unlock()
+}
+
+// startScheduled starts the session through the normal start path once the
+// scheduled time arrives. It runs on the room goroutine, queued by armSchedule.
+// Nothing happens if the room is empty or already running.
+func (r *Room) startScheduled(at time.Time) {
+	r.scheduleMux.Lock()
+	if !r.scheduledFor.Equal(at) {
+		// Rescheduled or cancelled while this timer fired
+		r.scheduleMux.Unlock()
+		return
+	}
+	r.scheduleMux.Unlock()
+	r.cancelSchedule()
+	r.persist()
+	r.startUnattended("scheduled")
+}
+
+// remindStart tells the room the session scheduled for at starts in startsIn.
+// It runs on the room goroutine, queued by armSchedule, and says nothing if
+// the start was moved or cancelled meanwhile.
+func (r *Room) remindStart(at time.Time, startsIn time.Duration) {
+	r.scheduleMux.Lock()
+	current := r.scheduledFor.Equal(at)
+	r.scheduleMux.Unlock()
+	if !current {
+		return
+	}
+	r.broadcast("startReminder", map[string]interface{}{
+		"type":           "broadcast",
+		"scheduledStart": at,
+		"startsIn":       startsIn.Seconds(),
+		"message":        fmt.Sprintf("Session starts in %s", startsIn),
+	})
+}
+
+// cancelSchedule_protocol lets the host or a co-host call off the scheduled start.
+func (r *Room) cancelSchedule_protocol(h *Client) error {
+	if !r.isHostOrCoHost(h) {
+		r.sendError(h, "Only the host or a co-host can cancel the schedule")
+		return fmt.Errorf("error in cancelSchedule_protocol: %s is not the host or a co-host", h.Id)
+	}
+	if r.scheduledStart() == nil {
+		r.sendError(h, "This room has no scheduled start")
+		return fmt.Errorf("error in cancelSchedule_protocol: room %s has no schedule", r.Id)
+	}
+	r.ConfigMux.Lock()
+	r.Config.ScheduledStart = nil
+	r.ConfigMux.Unlock()
+	r.audit(h, "cancelSchedule", nil)
+	r.syncSchedule()
+	r.persist()
+	return nil
+}
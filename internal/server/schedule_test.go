@@ -0,0 +1,112 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForProtocol reads h's messages until one arrives under protocol.
+func waitForProtocol(t *testing.T, h *Client, protocol string) ServerPacket {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case packet := <-h.MsgCh:
+			if packet.Header.Protocol == protocol {
+				return packet
+			}
+		case <-deadline:
+			t.Fatalf("no %s packet sent to %s", protocol, h.Username)
+		}
+	}
+}
+
+func TestScheduledStartRemindsAndStarts(t *testing.T) {
+	host := newTestHiker("1")
+	room := newTestRoom(host)
+	room.StartReminders = []time.Duration{time.Hour, 100 * time.Millisecond}
+	defer room.Timer.Stop()
+	serveRoom(t, room)
+
+	if err := room.applyRoomConfig(map[string]interface{}{"scheduledStart": time.Now().Add(-time.Minute)}); err == nil {
+		t.Fatal("expected a past scheduledStart to be rejected")
+	}
+
+	at := time.Now().Add(time.Hour)
+	if err := room.applyRoomConfig(map[string]interface{}{"scheduledStart": at}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+	room.syncSchedule()
+	if event := lastPacket(t, host).Response["event"]; event != "scheduled" {
+		t.Fatalf("expected scheduled event, got %v", event)
+	}
+
+	// Rescheduling replaces the first schedule's timers
+	at = time.Now().Add(200 * time.Millisecond)
+	if err := room.applyRoomConfig(map[string]interface{}{"scheduledStart": at}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+	room.syncSchedule()
+	if event := lastPacket(t, host).Response["event"]; event != "rescheduled" {
+		t.Fatalf("expected rescheduled event, got %v", event)
+	}
+
+	reminder := waitForProtocol(t, host, "startReminder")
+	if startsIn := reminder.Response["startsIn"]; startsIn != 0.1 {
+		t.Fatalf("expected reminder 0.1s before start, got %v", startsIn)
+	}
+	waitForProtocol(t, host, "start")
+	if !room.Timer.IsRunning || room.scheduledStart() != nil {
+		t.Fatal("expected the scheduled start to run and clear the schedule")
+	}
+}
+
+func TestCancelSchedule(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	room := newTestRoom(host, hiker)
+	room.StartReminders = nil
+	serveRoom(t, room)
+
+	if err := room.applyRoomConfig(map[string]interface{}{"scheduledStart": time.Now().Add(100 * time.Millisecond)}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+	room.syncSchedule()
+	if err := room.cancelSchedule_protocol(hiker); err == nil {
+		t.Fatal("expected a hiker to be refused")
+	}
+	if err := room.cancelSchedule_protocol(host); err != nil {
+		t.Fatalf("cancelSchedule failed: %v", err)
+	}
+	if event := lastPacket(t, hiker).Response["event"]; event != "cancelled" {
+		t.Fatalf("expected cancelled event, got %v", event)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if room.Timer.IsRunning {
+		t.Fatal("cancelled schedule should not start the timer")
+	}
+}
+
+func TestReminderAfterCancelIsDropped(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.StartReminders = []time.Duration{time.Minute}
+
+	if err := room.applyRoomConfig(map[string]interface{}{"scheduledStart": clock.Now().Add(10 * time.Minute)}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+	room.syncSchedule()
+	lastPacket(t, host)
+
+	// The reminder fires and waits for the room goroutine, which cancels first
+	clock.Advance(9 * time.Minute)
+	if len(host.MsgCh) != 0 {
+		t.Fatal("reminder sent off the room goroutine")
+	}
+	room.cancelSchedule()
+	runQueued(room)
+	if len(host.MsgCh) != 0 {
+		t.Fatalf("expected no reminder after the cancel, got %s", lastPacket(t, host).Header.Protocol)
+	}
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -18,10 +20,35 @@ type ServerInterface interface {
 }
 
 type Server struct {
-	mux     sync.RWMutex
-	Addr    string
-	Rooms   map[string]*Room
-	Clients map[*ws.Conn]bool
+	mux        sync.RWMutex
+	Addr       string
+	Rooms      map[string]*Room
+	Clients    map[*ws.Conn]bool
+	DenyList   *DenyList
+	AdminToken string // Bearer token for the /admin endpoints, disabled when empty
+	// UsernameCollision is the policy new rooms use when two hikers pick the
+	// same name, UsernameReject or UsernameSuffix
+	UsernameCollision string
+	// AuditSink receives privileged room actions, nothing is recorded when nil
+	AuditSink AuditSink
+	// MaxRoomSize caps how many hikers a room may hold, 0 for no limit
+	MaxRoomSize int
+	Lobby       *Lobby
+	// HostGracePeriod is how long a disconnected host can take to reconnect
+	// before the room elects a new host
+	HostGracePeriod time.Duration
+	// RoomLimits expire rooms, checked by the janitor every JanitorInterval
+	RoomLimits      RoomLimits
+	JanitorInterval time.Duration
+	janitorQuit     chan struct{}
+	// RoomStore keeps persistent rooms, which are disabled when nil
+	RoomStore *RoomStore
+	// Presets are the named timer setups keyed by lower case name
+	Presets map[string]Preset
+	// Clock drives room timers and schedules
+	Clock Clock
+	// StartReminders are broadcast this long before a room's scheduled start
+	StartReminders []time.Duration
 }
 
 type Header struct {
@@ -33,14 +60,33 @@ type Header struct {
 type ServerPacket struct {
 	Header   Header                 `json:"header"`
 	Response map[string]interface{} `json:"response"`
+	// closeConn tells the write pump to close the connection after sending
+	closeConn bool
+	// stampTransmit has the write pump add serverTransmitTime as it sends
+	stampTransmit bool
 }
 
 func NewServer(host string, port int) *Server {
-	return &Server{
-		Addr:    host + ":" + fmt.Sprint(port),
-		Rooms:   make(map[string]*Room),
-		Clients: make(map[*ws.Conn]bool),
+	s := &Server{
+		Addr:              host + ":" + fmt.Sprint(port),
+		Rooms:             make(map[string]*Room),
+		Clients:           make(map[*ws.Conn]bool),
+		DenyList:          newDenyList(""),
+		UsernameCollision: UsernameSuffix,
+		Lobby:             newLobby(),
+		HostGracePeriod:   30 * time.Second,
+		RoomLimits: RoomLimits{
+			IdleTimeout:      2 * time.Hour,
+			MaxLifetime:      24 * time.Hour,
+			CompletedTimeout: 30 * time.Minute,
+		},
+		JanitorInterval: time.Minute,
+		Presets:         make(map[string]Preset),
+		StartReminders:  DefaultStartReminders,
+		Clock:           RealClock{},
 	}
+	s.AddPresets(builtinPresets)
+	return s
 }
 
 func (s *Server) createWSConn(w http.ResponseWriter, r *http.Request) (*ws.Conn, error) {
@@ -62,6 +108,15 @@ func (s *Server) createWSConn(w http.ResponseWriter, r *http.Request) (*ws.Conn,
 	return wsConn, nil
 }
 
+// remoteIp returns the IP portion of the request's remote address.
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func (s *Server) addClient(c *ws.Conn) {
 
 	s.mux.Lock()
@@ -72,13 +127,18 @@ func (s *Server) addClient(c *ws.Conn) {
 func (s *Server) removeClient(c *Client) {
 	//close(c.MsgCh)
 	close(c.MsgCh)
+	s.Lobby.unsubscribe(c)
 	fmt.Println("Removing from room")
-	if c.RoomId != "" {
-		room, ok := s.Rooms[c.RoomId]
+	if roomId := c.takeRoomId(); roomId != "" {
+		s.mux.RLock()
+		room, ok := s.Rooms[roomId]
+		s.mux.RUnlock()
 		if ok && room != nil {
 			str := room.RemoveHiker(c)
 			if str == "close room" {
-				delete(s.Rooms, c.RoomId)
+				s.mux.Lock()
+				delete(s.Rooms, roomId)
+				s.mux.Unlock()
 				fmt.Println("Room closed")
 			}
 		}
@@ -92,6 +152,11 @@ func (s *Server) removeClient(c *Client) {
 }
 
 func (s *Server) handleNewConnection(w http.ResponseWriter, r *http.Request) {
+	if s.DenyList.DeniesIp(remoteIp(r)) {
+		http.Error(w, `{"protocol": "Error", "error": "denied"}`, http.StatusForbidden)
+		return
+	}
+
 	// Establish WebSocket connection
 	wsConn, err := s.createWSConn(w, r)
 	if err != nil {
@@ -106,6 +171,8 @@ func (s *Server) handleNewConnection(w http.ResponseWriter, r *http.Request) {
 	client := &Client{
 		Conn:  wsConn,
 		MsgCh: make(chan ServerPacket, 2048), // Buffered channel for outgoing messages
+		Ip:    remoteIp(r),
+		Clock: s.clock(),
 	}
 	s.addClient(wsConn)
 
@@ -130,30 +197,43 @@ func (s *Server) readLoop(c *Client) {
 			s.removeClient(c)
 			return
 		}
+		received := s.clock().Now()
+
+		//check server deny list before a client can enter a room
+		if clientPacket.Header.Protocol == "create" || clientPacket.Header.Protocol == "join" {
+			username, err := normalizeUsername(clientPacket.stringField("username"))
+			if err != nil {
+				s.sendError(c, err.Error())
+				continue
+			}
+			clientPacket.Message["username"] = username
+
+			candidate := &Client{Id: clientPacket.Header.UserId, Username: username, Ip: c.Ip}
+			if s.DenyList.DeniesClient(candidate) {
+				s.sendError(c, "You are not allowed on this server")
+				continue
+			}
+		}
 
 		//check incoming client message protocol
 		switch clientPacket.Header.Protocol {
 		case "create":
 			//create a new room
-			newRoom := &Room{
-				Id:      uuid.New().String(),
-				Hikers:  make(map[string]*Client, 1024),
-				Session: &Session{Level: 1, HighestCompletedLevel: 0},
-				Timer: &Timer{
-					FocusTime:      1500,
-					ShortBreakTime: 300,
-					LongBreakTime:  900,
-					Sets:           3,
-					CompletedSets:  0,
-					Pace:           2.0,
-				},
-				IncomingMsgs: make(chan *ClientPacket, 2048),
-				Host:         c.Id,
+			newRoom := s.newRoom(uuid.New().String())
+			newRoom.touch()
+			if clientPacket.boolField("persistent") {
+				//claims the slug and adds the room to Servers rooms
+				err := s.makePersistent(newRoom, clientPacket.stringField("slug"), clientPacket.Header.UserId)
+				if err != nil {
+					s.sendError(c, err.Error())
+					continue
+				}
+			} else {
+				//add room to Servers rooms
+				s.mux.Lock()
+				s.Rooms[newRoom.Id] = newRoom
+				s.mux.Unlock()
 			}
-			//add room to Servers rooms
-			s.mux.Lock()
-			s.Rooms[newRoom.Id] = newRoom
-			s.mux.Unlock()
 
 			//start new thread to handle new rooms messages
 			go newRoom.handleRoomMessages()
@@ -172,7 +252,7 @@ func (s *Server) readLoop(c *Client) {
 			clientPacket.Header.RoomId = newRoom.Id
 
 			//send message to room Channel
-			newRoom.IncomingMsgs <- clientPacket
+			newRoom.deliver(clientPacket)
 
 		case "join":
 			// Set username for the client
@@ -181,65 +261,145 @@ func (s *Server) readLoop(c *Client) {
 			// Set id for the client
 			c.Id = clientPacket.Header.UserId
 
-			// Retrieve the room by RoomId
-			roomRef, ok := s.Rooms[clientPacket.Header.RoomId]
+			// Retrieve the room by RoomId, or by slug for persistent rooms
+			roomRef, ok := s.findRoom(clientPacket.Header.RoomId)
+			if ok {
+				// Room exists, add client to room unless it closed meanwhile
+				ok = roomRef.deliver(clientPacket)
+			}
 			if !ok {
 				// Room does not exist, send error message to client
-				errMsg := map[string]interface{}{"message": "Room ID Does Not Exist"}
-
-				newPacket := ServerPacket{
-					Header: Header{
-						Protocol: "Error",
-						RoomId:   "",
-					},
-					Response: errMsg,
-				}
-
-				select {
-				case c.MsgCh <- newPacket:
-				default:
-					s.removeClient(c)
-				}
-			} else {
-				// Room exists, log room size and add client to room
-				fmt.Println("Amount of hikers in room:", len(roomRef.Hikers))
-				roomRef.IncomingMsgs <- clientPacket
+				s.sendRoomNotFound(c)
+			}
+		case "listRooms":
+			err := s.listRooms_protocol(c, clientPacket.Message)
+			if err != nil {
+				fmt.Printf("Error in listRooms protocol: %v", err)
+			}
+		case "subscribeLobby":
+			s.Lobby.subscribe(c)
+			err := s.listRooms_protocol(c, clientPacket.Message)
+			if err != nil {
+				fmt.Printf("Error in subscribeLobby protocol: %v", err)
 			}
+		case "unsubscribeLobby":
+			s.Lobby.unsubscribe(c)
+		case "listPresets":
+			s.listPresets_protocol(c)
+		case "timeSync":
+			s.timeSync_protocol(c, clientPacket, received)
 		default:
 			//check if room exiists on server
 			//if room doenst exist respond with error
 			//close connection
-			roomRef, ok := s.Rooms[clientPacket.Header.RoomId]
+			roomRef, ok := s.findRoom(clientPacket.Header.RoomId)
 			if !ok {
-				errMsg := map[string]interface{}{"message": "Room ID Does Not Exist"}
-
-				newPacket := ServerPacket{
-					Header: Header{
-						Protocol: "Error",
-						RoomId:   "",
-					},
-					Response: errMsg,
-				}
-
-				select {
-				case c.MsgCh <- newPacket:
-					//s.removeClient(c)
-				default:
-					s.removeClient(c)
-				}
+				s.sendRoomNotFound(c)
+				continue
 			}
 			//if room exists
 			fmt.Println("Room Found! Sending Message to room: ", clientPacket.Header.RoomId)
-			roomRef.IncomingMsgs <- clientPacket
+			if !roomRef.deliver(clientPacket) {
+				// Closed since it was found
+				s.sendRoomNotFound(c)
+			}
 
 		}
 	}
 }
 
+// newRoom builds an empty room with the server's room settings and the
+// default preset's timer.
+func (s *Server) newRoom(id string) *Room {
+	s.mux.RLock()
+	presets := make(map[string]Preset, len(s.Presets))
+	for key, preset := range s.Presets {
+		presets[key] = preset
+	}
+	s.mux.RUnlock()
+
+	timer := &Timer{Clock: s.Clock}
+	if preset, ok := presets[presetKey(DefaultPresetName)]; ok {
+		timer.setConfig(preset.Timer)
+		timer.Preset = preset.Name
+	}
+
+	return &Room{
+		Id:              id,
+		Hikers:          make(map[string]*Client, 1024),
+		Spectators:      make(map[string]*Client),
+		CoHosts:         make(map[string]bool),
+		Session:         &Session{Level: 1, HighestCompletedLevel: 0},
+		Timer:           timer,
+		presets:         presets,
+		IncomingMsgs:    make(chan *ClientPacket, 2048),
+		done:            make(chan struct{}),
+		Bans:            make(map[string]*Ban),
+		UsernamePolicy:  s.UsernameCollision,
+		Audit:           s.AuditSink,
+		ServerMaxHikers: s.MaxRoomSize,
+		lobby:           s.Lobby,
+		HostGracePeriod: s.HostGracePeriod,
+		StartReminders:  s.StartReminders,
+		Clock:           s.Clock,
+		CreatedAt:       s.clock().Now(),
+	}
+}
+
+func (s *Server) clock() Clock {
+	if s.Clock == nil {
+		return RealClock{}
+	}
+	return s.Clock
+}
+
+// sendRoomNotFound tells c the room it addressed doesn't exist, dropping the
+// client if its channel is full.
+func (s *Server) sendRoomNotFound(c *Client) {
+	errMsg := map[string]interface{}{"message": "Room ID Does Not Exist"}
+
+	newPacket := ServerPacket{
+		Header: Header{
+			Protocol: "Error",
+			RoomId:   "",
+		},
+		Response: errMsg,
+	}
+
+	select {
+	case c.MsgCh <- newPacket:
+	default:
+		s.removeClient(c)
+	}
+}
+
+// sendError sends an Error packet with message directly to c.
+func (s *Server) sendError(c *Client, message string) {
+	newPacket := ServerPacket{
+		Header: Header{
+			Protocol: "Error",
+			RoomId:   "",
+		},
+		Response: map[string]interface{}{"message": message},
+	}
+
+	select {
+	case c.MsgCh <- newPacket:
+	default:
+		s.removeClient(c)
+	}
+}
+
 func (s *Server) Stop() error {
 	//Stop listene
 	fmt.Println("Server stopped listening")
 
+	//Stop the room janitor
+	if s.janitorQuit != nil {
+		close(s.janitorQuit)
+		s.janitorQuit = nil
+	}
+
 	//Shutdown Rooms
 	for roomId, _ := range s.Rooms {
 		delete(s.Rooms, roomId)
@@ -262,6 +422,17 @@ func (s *Server) Start() error {
 
 	// Set up the handler for new connections
 	http.HandleFunc("/groupsession", s.handleNewConnection)
+	http.HandleFunc("/admin/denylist", s.handleDenyList)
+	http.HandleFunc("/rooms", s.handleRooms)
+
+	// Bring back persistent rooms from the last run
+	s.restoreRooms()
+
+	// Expire abandoned rooms in the background
+	if s.JanitorInterval > 0 {
+		s.janitorQuit = make(chan struct{})
+		go s.runJanitor(s.janitorQuit)
+	}
 
 	// Run ListenAndServe in a separate goroutine to prevent blocking
 	go func() {
@@ -9,6 +9,7 @@ type Session struct {
 	SessionMux            sync.RWMutex `json:"-"`
 	Name                  string       `json:"name"`
 	Distance              float64      `json:"distance"`
+	OvertimeDistance      float64      `json:"overtimeDistance"` // Covered by hikers in overtime, not part of Distance
 	Level                 uint8        `json:"level"`
 	HighestCompletedLevel uint8        `json:"highestCompletedLevel"`
 	Strikes               uint8        `json:"strikes"`
@@ -16,10 +17,32 @@ type Session struct {
 	BonusTokens           uint8        `json:"bonusTokens"`
 }
 
+// copy returns the session's values without its lock. The caller must hold
+// SessionMux.
+func (s *Session) copy() *Session {
+	c := &Session{}
+	c.assign(s)
+	return c
+}
+
+// assign sets the session's values to those of o. The caller must hold
+// SessionMux.
+func (s *Session) assign(o *Session) {
+	s.Name = o.Name
+	s.Distance = o.Distance
+	s.OvertimeDistance = o.OvertimeDistance
+	s.Level = o.Level
+	s.HighestCompletedLevel = o.HighestCompletedLevel
+	s.Strikes = o.Strikes
+	s.TokensEarned = o.TokensEarned
+	s.BonusTokens = o.BonusTokens
+}
+
 func (s *Session) Reset() {
 	s.SessionMux.Lock()
 	defer s.SessionMux.Unlock()
 	s.Distance = 0.0
+	s.OvertimeDistance = 0.0
 	s.Level = 0
 	s.HighestCompletedLevel = 0
 	s.Strikes = 0
@@ -0,0 +1,72 @@
+package server
+
+import "fmt"
+
+// spectate_protocol adds h as a spectator. Spectators receive every room
+// broadcast but are never hikers: they don't accrue distance, don't count
+// toward ready checks or capacity and can't become host.
+func (r *Room) spectate_protocol(h *Client) error {
+	if r.isBanned(h) {
+		r.sendError(h, "You are banned from this room")
+		return fmt.Errorf("spectator %s is banned from room %s", h.Id, r.Id)
+	}
+
+	r.HikersMux.Lock()
+	if _, ok := r.Hikers[h.Id]; ok {
+		r.HikersMux.Unlock()
+		r.sendError(h, "You are already hiking in this room")
+		return fmt.Errorf("hiker %s cannot also spectate room %s", h.Id, r.Id)
+	}
+	if r.Spectators == nil {
+		r.Spectators = make(map[string]*Client)
+	}
+	h.IsSpectator = true
+	h.IsReady = false
+	h.setRoomId(r.Id)
+	r.Spectators[h.Id] = h
+	r.HikersMux.Unlock()
+	fmt.Printf("Spectator %s added to room %s\n", h.Username, r.Id)
+
+	return r.responseFactory("spectate", h)
+}
+
+// removeSpectator drops h from the spectators and reports whether it was one.
+func (r *Room) removeSpectator(h *Client) bool {
+	r.HikersMux.Lock()
+	defer r.HikersMux.Unlock()
+	if _, ok := r.Spectators[h.Id]; !ok {
+		return false
+	}
+	delete(r.Spectators, h.Id)
+	return true
+}
+
+// spectatorsSnapshot copies the spectators map for sending.
+func (r *Room) spectatorsSnapshot() map[string]*Client {
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	snapshot := make(map[string]*Client, len(r.Spectators))
+	for k, v := range r.Spectators {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// recipients returns every hiker and spectator that should get a broadcast.
+func (r *Room) recipients() []*Client {
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	recipients := make([]*Client, 0, len(r.Hikers)+len(r.Spectators))
+	for _, hiker := range r.Hikers {
+		recipients = append(recipients, hiker)
+	}
+	for _, spectator := range r.Spectators {
+		recipients = append(recipients, spectator)
+	}
+	return recipients
+}
+
+// spectatorAllowed lists the protocols a spectator may send to its room.
+func spectatorAllowed(protocol string) bool {
+	return protocol == "leave"
+}
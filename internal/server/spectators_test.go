@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpectatorsWatchWithoutHiking(t *testing.T) {
+	host := newTestHiker("1")
+	hiker := newTestHiker("2")
+	room, clock := newClockedRoom(t, host, hiker)
+
+	coach := newTestHiker("coach")
+	if err := room.spectate_protocol(coach); err != nil {
+		t.Fatalf("spectate failed: %v", err)
+	}
+	reply := lastPacket(t, coach)
+	if reply.Response["role"] != "spectator" {
+		t.Fatalf("expected spectator reply, got %+v", reply.Response)
+	}
+	if _, ok := room.Hikers[coach.Id]; ok {
+		t.Fatal("spectator listed as hiker")
+	}
+
+	// Spectators get updates but never accrue distance
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(time.Minute)
+	room.update_protocol()
+	if packet := lastPacket(t, coach); packet.Header.Protocol != "update" {
+		t.Fatalf("expected update broadcast, got %s", packet.Header.Protocol)
+	}
+	if coach.Distance != 0 {
+		t.Fatalf("spectator accrued distance %f", coach.Distance)
+	}
+	if host.Distance == 0 {
+		t.Fatal("hiker did not accrue distance")
+	}
+
+	// Host election skips spectators
+	room.RemoveHiker(host)
+	if room.Host != hiker.Id || coach.IsHost {
+		t.Fatalf("expected hiker to become host, got %s", room.Host)
+	}
+
+	// Last hiker leaving closes the room on the spectator
+	room.RemoveHiker(hiker)
+	if packet := lastPacket(t, coach); packet.Header.Protocol != "roomClosed" {
+		t.Fatalf("expected roomClosed notice, got %s", packet.Header.Protocol)
+	}
+}
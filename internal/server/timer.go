@@ -1,55 +1,255 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// Timer runs a room's session through its phases, see phase.go. IsRunning,
+// IsBreak and IsCompleted mirror Phase for older clients.
 type Timer struct {
-	TimerMux       sync.RWMutex  `json:"-"`
-	StartTime      string        `json:"startTime"`
-	StartTimestamp time.Time     `json:"-"`        // Store the actual start time
-	Duration       time.Duration `json:"duration"` // Duration of the current phase (focus or break)
-	IsCompleted    bool          `json:"isCompleted"`
-	IsRunning      bool          `json:"isRunning"`
-	IsBreak        bool          `json:"isBreak"`
-	FocusTime      uint16        `json:"focusTime"`
-	ShortBreakTime uint16        `json:"shortBreakTime"`
-	LongBreakTime  uint16        `json:"longBreakTime"`
-	Sets           uint8         `json:"sets"`
-	CompletedSets  uint8         `json:"completedSets"`
-	Pace           float32       `json:"pace"`
-	AutoContinue   bool          `json:"autoContinue"`
-	CountdownTimer *time.Timer   `json:"-"`
-	UpdateTicker   *time.Ticker  `json:"-"`
-	quit           chan struct{} `json:"-"`
-	wg             sync.WaitGroup
-}
-
-func (t *Timer) BeginFocusTime(r *Room) {
+	TimerMux        sync.RWMutex  `json:"-"`
+	Phase           Phase         `json:"phase"`
+	StartTime       string        `json:"startTime"`
+	StartTimestamp  time.Time     `json:"-"` // Store the actual start time
+	Duration        time.Duration `json:"-"` // Length of the current phase, sent in seconds by MarshalJSON
+	Adjusted        time.Duration `json:"-"` // Net adjustTime change to the current phase
+	IsCompleted     bool          `json:"isCompleted"`
+	CompletedAt     time.Time     `json:"-"` // When the end-of-session modal was shown
+	IsRunning       bool          `json:"isRunning"`
+	IsBreak         bool          `json:"isBreak"`
+	IsPaused        bool          `json:"isPaused"` // The whole room is paused
+	PausedAt        time.Time     `json:"-"`
+	FocusTime       uint16        `json:"focusTime"`
+	ShortBreakTime  uint16        `json:"shortBreakTime"`
+	LongBreakTime   uint16        `json:"longBreakTime"`
+	CountdownTime   uint16        `json:"countdownTime"` // Pre-start countdown, 0 to start focus right away
+	Warnings        []uint16      `json:"warnings"`      // Seconds left in a phase when timeWarning is sent
+	Sets            uint8         `json:"sets"`
+	CompletedSets   uint8         `json:"completedSets"`
+	Pace            float32       `json:"pace"`
+	UpdateEvery     uint16        `json:"updateEvery"` // Seconds between update broadcasts, 0 for every 0.01 miles
+	AutoContinue    bool          `json:"autoContinue"`
+	Flowtime        bool          `json:"flowtime"`       // Focus runs until stopFocus, see flowtime.go
+	BreakRatio      float32       `json:"breakRatio"`     // Flowtime break length per second of focus
+	OvertimeRate    float32       `json:"overtimeRate"`   // Pace multiplier for hikers in overtime
+	LongBreakEvery  uint8         `json:"longBreakEvery"` // Sets per cycle, see TimerConfig
+	Cycles          uint8         `json:"cycles"`
+	EventDifficulty uint8         `json:"eventDifficulty"`
+	Preset          string        `json:"preset"`        // Name of the preset last applied, "" once customized
+	Intervals       []Interval    `json:"intervals"`     // Custom schedule, see intervals.go
+	IntervalIndex   int           `json:"intervalIndex"` // Position in Intervals
+	CountdownTimer  ClockTimer    `json:"-"`
+	phaseEnd        func()        // Runs when CountdownTimer fires, kept to resume after a pause
+	warningTimers   []ClockTimer
+	warningsArmed   uint64        // Counts stopWarnings calls, so queued warnings from before are dropped
+	accruedAt       time.Time     // Time up to here has been added to the hikers' distance
+	flowBreakTime   uint16        // Length of the break after the last flowtime focus block
+	UpdateTicker    ClockTicker   `json:"-"`
+	Clock           Clock         `json:"-"` // Wall clock when nil
+	quit            chan struct{} `json:"-"`
+	wg              sync.WaitGroup
+}
+
+// minUpdateInterval keeps very high paces from flooding the room with updates.
+const minUpdateInterval = 10 * time.Millisecond
+
+func (t *Timer) clock() Clock {
+	if t.Clock == nil {
+		return RealClock{}
+	}
+	return t.Clock
+}
+
+// toDuration converts a setting in seconds to a time.Duration.
+func toDuration(seconds uint16) time.Duration {
+	return time.Duration(seconds) * time.Second
+}
+
+// MarshalJSON sends the phase Duration in seconds like the other timer
+// settings, along with the planned schedule. phaseStartedAt, phaseEndsAt and
+// serverTime are Unix milliseconds, so clients that ran timeSync can render
+// the countdown from the deadline rather than a remainingTime that aged in
+// transit. phaseEndsAt is null while paused or when the phase has no end.
+// Flowtime focus sends the seconds it has run as elapsed instead.
+func (t *Timer) MarshalJSON() ([]byte, error) {
+	type timerJSON Timer
+	var startedAt, endsAt *int64
+	var elapsed *float64
+	if t.openEnded() {
+		seconds := t.elapsed().Seconds()
+		elapsed = &seconds
+	}
+	if t.currentPhase() != PhaseIdle {
+		started := t.StartTimestamp.UnixMilli()
+		startedAt = &started
+		if t.IsRunning && !t.IsPaused && t.Duration > 0 && t.currentPhase() != PhaseAwaitingDecision {
+			ends := t.StartTimestamp.Add(t.Duration).UnixMilli()
+			endsAt = &ends
+		}
+	}
+	return json.Marshal(struct {
+		*timerJSON
+		Duration       float64     `json:"duration"`
+		Adjusted       float64     `json:"adjusted"`
+		Schedule       []PhaseStep `json:"schedule"`
+		PhaseStartedAt *int64      `json:"phaseStartedAt"`
+		PhaseEndsAt    *int64      `json:"phaseEndsAt"`
+		Elapsed        *float64    `json:"elapsed,omitempty"`
+		ServerTime     int64       `json:"serverTime"`
+	}{(*timerJSON)(t), t.Duration.Seconds(), t.Adjusted.Seconds(), t.plannedSchedule(), startedAt, endsAt, elapsed, t.clock().Now().UnixMilli()})
+}
+
+// Start begins the session, through the pre-start countdown when
+// CountdownTime is set.
+func (t *Timer) Start(r *Room) error {
 	t.TimerMux.Lock()
-	t.StartTimestamp = time.Now()
-	//just starting
-	t.IsRunning = true
-	t.IsBreak = false
-	t.Duration = time.Duration(t.FocusTime) // time.Duration(t.FocusTime) * time.Se
-	t.UpdateTicker = time.NewTicker(time.Duration((0.01/t.Pace)*3600) * time.Second)
-	t.quit = make(chan struct{})
+	if phase := t.currentPhase(); phase != PhaseIdle && phase != PhaseCompleted {
+		t.TimerMux.Unlock()
+		return fmt.Errorf("the session is already in %s", phase)
+	}
+	if t.CountdownTime == 0 {
+		t.TimerMux.Unlock()
+		return t.BeginFocusTime(r)
+	}
+	from, err := t.transition(PhaseCountdown)
+	if err != nil {
+		t.TimerMux.Unlock()
+		return err
+	}
+	t.startCountdown(r, t.Duration, func() {
+		t.BeginFocusTime(r)
+		r.touch()
+		r.publishLobby()
+	})
+	t.TimerMux.Unlock()
+
+	r.phaseChanged(from, PhaseCountdown)
+	return nil
+}
+
+// BeginFocusTime starts a focus block and the distance updates. A custom
+// schedule that ends on a break goes to the end modal instead.
+func (t *Timer) BeginFocusTime(r *Room) error {
+	// Settle the break's overtime before the phase clock restarts
+	r.accrue()
+	t.TimerMux.Lock()
+	index := t.IntervalIndex
+	if len(t.Intervals) > 0 {
+		next := PhaseFocus
+		switch t.currentPhase() {
+		case PhaseShortBreak, PhaseLongBreak:
+			next, t.IntervalIndex = t.nextInterval()
+		case PhaseAwaitingDecision:
+			// Extra sets, extend picked the interval
+		default:
+			t.IntervalIndex = 0
+		}
+		if next == PhaseAwaitingDecision {
+			from, err := t.transition(next)
+			t.TimerMux.Unlock()
+			if err != nil {
+				return err
+			}
+			t.StopTicker()
+			r.announcePhase(from, next)
+			return nil
+		}
+	}
+	from, err := t.transition(PhaseFocus)
+	if err != nil {
+		t.IntervalIndex = index
+		t.TimerMux.Unlock()
+		return err
+	}
 
 	if t.StartTime == "" {
-		t.StartTime = time.Now().String()
+		t.StartTime = t.clock().Now().String()
 
 	}
-	//After first param 0 , run 2nd param
-	//var is a *timer to stop /cancel func from happening
-	t.CountdownTimer = time.AfterFunc(time.Duration(t.FocusTime)*time.Second, func() {
-		//SetBreak Resets Timer for Break && sets IsBreak bool
-		r.update_protocol()
-		t.SetBreak(r)
-	})
+	if t.Duration > 0 {
+		//After first param 0 , run 2nd param
+		//var is a *timer to stop /cancel func from happening
+		t.startCountdown(r, t.Duration, func() {
+			//SetBreak Resets Timer for Break && sets IsBreak bool
+			r.update_protocol()
+			t.SetBreak(r)
+			r.touch()
+			r.publishLobby()
+		})
+	} else {
+		// Flowtime focus runs until stopFocus
+		t.phaseEnd = nil
+		t.stopWarnings()
+	}
+	t.startUpdates(r)
 	t.TimerMux.Unlock()
 
+	r.endOvertime()
+	r.phaseChanged(from, PhaseFocus)
+	return nil
+}
+
+// beginFocusAfterBreak is the phaseEnd of a break.
+func (t *Timer) beginFocusAfterBreak(r *Room) func() {
+	return func() {
+		r.update_protocol()
+		t.BeginFocusTime(r)
+		r.touch()
+		r.publishLobby()
+	}
+}
+
+// startCountdown runs phaseEnd once d has passed, replacing any pending
+// countdown, and arms the phase's warnings. The caller must hold TimerMux.
+func (t *Timer) startCountdown(r *Room, d time.Duration, phaseEnd func()) {
+	if t.CountdownTimer != nil {
+		t.CountdownTimer.Stop()
+	}
+	t.phaseEnd = phaseEnd
+	t.CountdownTimer = t.clock().AfterFunc(d, phaseEnd)
+	t.armWarnings(r, d)
+}
+
+// updateInterval is how often the room gets an update: every UpdateEvery
+// seconds, or every 0.01 miles at the effective pace in miles per hour but no
+// more often than minUpdateInterval. It is 0 when neither is set and no
+// updates are sent. Distance accrues by time either way, see accrue.
+func (t *Timer) updateInterval() time.Duration {
+	if t.UpdateEvery > 0 {
+		return toDuration(t.UpdateEvery)
+	}
+	pace := t.effectivePace()
+	if pace <= 0 {
+		return 0
+	}
+	interval := time.Duration(0.01 / float64(pace) * float64(time.Hour))
+	if interval < minUpdateInterval {
+		interval = minUpdateInterval
+	}
+	return interval
+}
+
+// startUpdates starts the ticker that accrues distance during focus time,
+// replacing the previous phase's ticker. The caller must hold TimerMux.
+func (t *Timer) startUpdates(r *Room) {
+	if t.UpdateTicker != nil {
+		t.UpdateTicker.Stop()
+	}
+	if t.quit != nil {
+		// The old goroutine may be waiting on TimerMux, so don't wait for it here
+		close(t.quit)
+		t.quit = nil
+	}
+	interval := t.updateInterval()
+	if interval == 0 {
+		return
+	}
+	t.UpdateTicker = t.clock().NewTicker(interval)
+	t.quit = make(chan struct{})
+
 	t.wg.Add(1)
 	ticker := t.UpdateTicker
 	quit := t.quit
@@ -57,61 +257,120 @@ func (t *Timer) BeginFocusTime(r *Room) {
 		defer t.wg.Done()
 		for {
 			select {
-			case <-ticker.C:
-				r.update_protocol() // Periodically updates session and unpaused user distance
+			case <-ticker.C():
+				r.update_protocol() // Accrues unpaused hiker distance and broadcasts it
 			case <-quit:
 				return
 			}
 		}
 	}()
+}
 
+// ExtraSet adds one set after the session's last set, starting with a long break.
+func (t *Timer) ExtraSet(r *Room) error {
+	return t.extend(r, 1)
 }
 
-func (t *Timer) ExtraSet(r *Room) {
-	//lock Timer
-	t.TimerMux.Lock()
-	defer t.TimerMux.Unlock()
-	//increase set by 1
-	t.Sets++
-	//set long Break Time
-	t.CountdownTimer = time.AfterFunc(time.Duration(t.LongBreakTime)*time.Second, func() {
-		t.BeginFocusTime(r)
-	})
+// ExtraSession adds three sets after the session's last set, starting with a long break.
+func (t *Timer) ExtraSession(r *Room) error {
+	return t.extend(r, 3)
 }
 
-func (t *Timer) ExtraSession(r *Room) {
-	//lock Timer
+// extend adds sets to a session waiting on the end modal. A custom schedule
+// that ends on a break goes straight to the first added focus block.
+func (t *Timer) extend(r *Room, sets uint8) error {
 	t.TimerMux.Lock()
-	defer t.TimerMux.Unlock()
-	//increase set by 1
-	t.Sets += 3
-	//set long Break Time
-	t.CountdownTimer = time.AfterFunc(time.Duration(t.LongBreakTime)*time.Second, func() {
-		t.BeginFocusTime(r)
-	})
-}
+	if t.currentPhase() != PhaseAwaitingDecision {
+		t.TimerMux.Unlock()
+		return fmt.Errorf("sets can only be added once the last set is done")
+	}
+	intervals, index := t.Intervals, t.IntervalIndex
+	if len(t.Intervals) > 0 {
+		if err := t.appendSets(sets); err != nil {
+			t.TimerMux.Unlock()
+			return err
+		}
+		t.IntervalIndex = len(intervals)
+		if intervals[len(intervals)-1].Kind.isBreak() {
+			// The schedule's last break already ran, go straight to focus
+			t.TimerMux.Unlock()
+			if err := t.BeginFocusTime(r); err != nil {
+				t.TimerMux.Lock()
+				t.setIntervals(intervals)
+				t.IntervalIndex = index
+				t.TimerMux.Unlock()
+				return err
+			}
+			return nil
+		}
+	}
+	from, err := t.transition(PhaseLongBreak)
+	if err != nil {
+		t.Intervals, t.IntervalIndex = intervals, index
+		t.TimerMux.Unlock()
+		return err
+	}
+	if len(intervals) == 0 {
+		t.Sets += sets
+	}
+	t.startCountdown(r, t.Duration, t.beginFocusAfterBreak(r))
+	t.TimerMux.Unlock()
 
-func (t *Timer) SkipBreak(r *Room) {
+	r.phaseChanged(from, PhaseLongBreak)
+	return nil
+}
 
+// SkipBreak ends the current break and starts focus right away.
+func (t *Timer) SkipBreak(r *Room) error {
 	t.TimerMux.Lock()
-	defer t.TimerMux.Unlock()
-	t.CountdownTimer = time.AfterFunc(time.Duration(t.FocusTime)*time.Second, func() {
-		t.BeginFocusTime(r)
-	})
+	if !t.currentPhase().isBreak() {
+		t.TimerMux.Unlock()
+		return fmt.Errorf("cannot skip a break during %s", t.currentPhase())
+	}
+	if t.CountdownTimer != nil && !t.CountdownTimer.Stop() {
+		// The break ended on its own
+		t.TimerMux.Unlock()
+		return fmt.Errorf("the break is already over")
+	}
+	t.stopWarnings()
+	t.TimerMux.Unlock()
+	return t.BeginFocusTime(r)
 }
 
+// SetBreak ends a focus block with the break breakAfter picks, or the end
+// modal. A custom schedule moves on to its next interval.
 func (t *Timer) SetBreak(r *Room) error {
-	//stop updating
+	// Settle the focus block before the phase clock restarts
+	r.accrue()
 	t.TimerMux.Lock()
-	defer t.TimerMux.Unlock()
 
-	//set isBreak to True
-	t.IsBreak = true
 	//set timer.completedsets + 1
 	t.CompletedSets++
-	//reset time tracking
-	t.StartTimestamp = time.Now()
-	t.Duration = time.Duration(t.ShortBreakTime)
+	next := t.breakAfter(t.CompletedSets)
+	index := t.IntervalIndex
+	if len(t.Intervals) > 0 {
+		next, t.IntervalIndex = t.nextInterval()
+	}
+	from, err := t.transition(next)
+	if err != nil {
+		t.CompletedSets--
+		t.IntervalIndex = index
+		t.TimerMux.Unlock()
+		return err
+	}
+	if next != PhaseAwaitingDecision {
+		//Break Timer begins, will call BeginFocusTime once breakTime is Reached
+		t.startCountdown(r, t.Duration, t.beginFocusAfterBreak(r))
+	}
+	t.TimerMux.Unlock()
+
+	r.announcePhase(from, next)
+	return nil
+}
+
+// announcePhase broadcasts phaseChanged, followed by the endModal or
+// shortBreak older clients switch on.
+func (r *Room) announcePhase(from Phase, next Phase) {
 	//get snapshot of all hikers data
 	r.HikersMux.RLock()
 	hikersSnapshot := make(map[string]*Client, len(r.Hikers))
@@ -120,45 +379,44 @@ func (t *Timer) SetBreak(r *Room) error {
 	}
 	r.HikersMux.RUnlock()
 
-	//check which break should be set
-	//if completed all sets send message to show modal
-	if t.CompletedSets == t.Sets {
-		if t.AutoContinue == true {
-			//set long Break Time
-			t.CountdownTimer = time.AfterFunc(time.Duration(t.LongBreakTime)*time.Second, func() {
-				t.BeginFocusTime(r)
-			})
-			return nil
-		}
-
+	r.phaseChanged(from, next)
+	switch next {
+	case PhaseAwaitingDecision:
 		//Broadcast Completed Message to all hikers
 		//EndModal protocol tells UI to display modal to host to end or continue
-		//UI will send endSession protocol, if continue session protocol isnt sent within x seconds
+		//If nobody decides by decisionDeadline the server takes defaultAction
+		deadline, action := r.armDecision()
 		r.broadcast("endModal", map[string]interface{}{
+			"type":             "broadcast",
+			"session":          r.Session,
+			"timer":            r.Timer,
+			"hikers":           hikersSnapshot,
+			"message":          "Congrats, You Finished!",
+			"decisionDeadline": deadline.UnixMilli(),
+			"decisionTimeout":  deadline.Sub(r.clock().Now()).Seconds(),
+			"defaultAction":    action,
+		})
+	case PhaseShortBreak:
+		//Broadcast "shortBreak" protocol tells ui to switch to break mode
+		r.broadcast("shortBreak", map[string]interface{}{
 			"type":    "broadcast",
 			"session": r.Session,
 			"timer":   r.Timer,
 			"hikers":  hikersSnapshot,
-			"message": "Congrats, You Finished!",
 		})
-		return nil
 	}
-	//Timers Break Timer begins, will call BeginFocusTime once breakTime is Reached
-	t.CountdownTimer = time.AfterFunc(time.Duration(t.ShortBreakTime)*time.Second, func() {
-		r.update_protocol()
-		t.BeginFocusTime(r)
-	})
+}
 
-	//broadcast to users its break time
-	message := map[string]interface{}{
-		"type":    "broadcast",
-		"session": r.Session,
-		"timer":   r.Timer,
-		"hikers":  hikersSnapshot,
+// End stops a running session, moving the timer to PhaseCompleted.
+func (t *Timer) End(r *Room) error {
+	t.TimerMux.Lock()
+	from, err := t.transition(PhaseCompleted)
+	t.TimerMux.Unlock()
+	if err != nil {
+		return err
 	}
-
-	//Broadcast "shortBreak" protocol tells ui to switch to break mode
-	r.broadcast("shortBreak", message)
+	t.StopTicker()
+	r.phaseChanged(from, PhaseCompleted)
 	return nil
 }
 
@@ -167,11 +425,11 @@ func (t *Timer) RemainingTime() time.Duration {
 	defer t.TimerMux.RUnlock()
 	fmt.Println("in Remaining Time, Timer.Duration is:", t.Duration)
 	//seconds
-	elapsed := time.Since(t.StartTimestamp)
+	elapsed := t.elapsed()
 
 	fmt.Println("in Remaining Time, elapsed.seconds() is:", elapsed.Seconds())
 
-	remaining := t.Duration*time.Second - elapsed
+	remaining := t.Duration - elapsed
 
 	fmt.Println("Final Remaining Time", remaining)
 	if remaining < 0 {
@@ -180,6 +438,16 @@ func (t *Timer) RemainingTime() time.Duration {
 	return time.Duration(remaining)
 }
 
+// elapsed is how long the current phase has run. Resuming moves
+// StartTimestamp past the pause, and a paused phase is frozen where it was
+// paused, so pauses don't count. The caller must hold TimerMux.
+func (t *Timer) elapsed() time.Duration {
+	if t.IsPaused {
+		return t.PausedAt.Sub(t.StartTimestamp)
+	}
+	return t.clock().Now().Sub(t.StartTimestamp)
+}
+
 // StopTicker stops the UpdateTicker and signals the update goroutine to exit.
 func (t *Timer) StopTicker() {
 	t.TimerMux.Lock()
@@ -193,3 +461,59 @@ func (t *Timer) StopTicker() {
 	t.TimerMux.Unlock()
 	t.wg.Wait()
 }
+
+// Stop cancels the countdown and the update ticker and resets the timer to
+// PhaseIdle without telling the room.
+func (t *Timer) Stop() {
+	t.StopTicker()
+	t.TimerMux.Lock()
+	defer t.TimerMux.Unlock()
+	t.transition(PhaseIdle)
+}
+
+// Pause freezes the countdown and stops distance accrual, keeping the exact
+// time left in the current phase.
+func (t *Timer) Pause() error {
+	t.TimerMux.Lock()
+	if t.IsPaused || !t.IsRunning || t.currentPhase() == PhaseAwaitingDecision {
+		t.TimerMux.Unlock()
+		return fmt.Errorf("the timer is not running")
+	}
+	// Open-ended flowtime focus has no countdown to stop
+	if t.phaseEnd != nil && t.CountdownTimer != nil && !t.CountdownTimer.Stop() {
+		// The phase ended as we paused, its callback is already running
+		t.TimerMux.Unlock()
+		return fmt.Errorf("the phase is changing, try again")
+	}
+	t.stopWarnings()
+	t.IsPaused = true
+	t.PausedAt = t.clock().Now()
+	t.TimerMux.Unlock()
+
+	t.StopTicker()
+	return nil
+}
+
+// Resume restarts a paused countdown with the time it had left.
+func (t *Timer) Resume(r *Room) error {
+	t.TimerMux.Lock()
+	defer t.TimerMux.Unlock()
+	if !t.IsPaused {
+		return fmt.Errorf("the timer is not paused")
+	}
+	remaining := t.Duration - t.PausedAt.Sub(t.StartTimestamp)
+	// Shift the phase start, and the accrued distance, by the time spent paused
+	paused := t.clock().Now().Sub(t.PausedAt)
+	t.StartTimestamp = t.StartTimestamp.Add(paused)
+	t.accruedAt = t.accruedAt.Add(paused)
+	t.IsPaused = false
+	t.PausedAt = time.Time{}
+
+	if t.phaseEnd != nil {
+		t.startCountdown(r, remaining, t.phaseEnd)
+	}
+	if phase := t.currentPhase(); phase == PhaseFocus || (phase.isBreak() && r.anyOvertime()) {
+		t.startUpdates(r)
+	}
+	return nil
+}
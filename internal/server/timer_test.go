@@ -6,19 +6,13 @@ import (
 )
 
 func TestTickerStopTerminatesGoroutine(t *testing.T) {
-	timer := &Timer{FocusTime: 1, Pace: 1000}
-	h := &Client{Id: "1", Username: "test", MsgCh: make(chan ServerPacket, 1)}
-	room := &Room{
-		Id:      "room1",
-		Hikers:  map[string]*Client{"1": h},
-		Session: &Session{},
-		Timer:   timer,
-		Host:    "1",
-	}
+	h := newTestHiker("1")
+	room, clock := newClockedRoom(t, h)
+	timer := room.Timer
 
 	timer.BeginFocusTime(room)
-	// allow goroutine to start
-	time.Sleep(10 * time.Millisecond)
+	// Let the update goroutine tick a few times
+	clock.Advance(30 * time.Second)
 	timer.StopTicker()
 
 	done := make(chan struct{})
@@ -29,7 +23,7 @@ func TestTickerStopTerminatesGoroutine(t *testing.T) {
 
 	select {
 	case <-done:
-	case <-time.After(100 * time.Millisecond):
+	case <-time.After(time.Second):
 		t.Fatal("update goroutine did not terminate")
 	}
 }
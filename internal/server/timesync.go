@@ -0,0 +1,30 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeSync_protocol answers an NTP style clock probe. The client sends its
+// clientTime (t0) and the reply echoes it with serverReceiveTime (t1) and
+// serverTransmitTime (t2), which the write pump stamps as the reply goes out.
+// With t3 as its own receive time the client estimates its clock offset as
+// ((t1 - t0) + (t2 - t3)) / 2 and the round trip as (t3 - t0) - (t2 - t1).
+// All times are Unix milliseconds.
+func (s *Server) timeSync_protocol(c *Client, packet *ClientPacket, received time.Time) {
+	reply := ServerPacket{
+		Header: Header{Protocol: "timeSync", UserId: c.Id},
+		Response: map[string]interface{}{
+			"type":              "direct",
+			"status":            "success",
+			"clientTime":        packet.Message["clientTime"],
+			"serverReceiveTime": received.UnixMilli(),
+		},
+		stampTransmit: true,
+	}
+	select {
+	case c.MsgCh <- reply:
+	default:
+		fmt.Printf("timeSync reply dropped for %v\n", c.Username)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTimeSyncEchoesClientTime(t *testing.T) {
+	s := NewServer("", 0)
+	c := newTestHiker("1")
+	received := time.UnixMilli(1700000000123)
+	packet := &ClientPacket{Message: map[string]interface{}{"clientTime": 1700000000000.0}}
+
+	s.timeSync_protocol(c, packet, received)
+	reply := lastPacket(t, c)
+	if reply.Header.Protocol != "timeSync" || !reply.stampTransmit {
+		t.Fatalf("expected a timeSync reply stamped on send, got %+v", reply)
+	}
+	if reply.Response["clientTime"] != 1700000000000.0 || reply.Response["serverReceiveTime"] != int64(1700000000123) {
+		t.Fatalf("unexpected reply %v", reply.Response)
+	}
+}
+
+func TestTimeSyncUsesServerClock(t *testing.T) {
+	s := NewServer("", 0)
+	clock := NewFakeClock(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	s.Clock = clock
+	httpServer := httptest.NewServer(http.HandlerFunc(s.handleNewConnection))
+	defer httpServer.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	probe := map[string]map[string]interface{}{"header": {"protocol": "timeSync"}, "message": {"clientTime": 1}}
+	if err := conn.WriteJSON(probe); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reply := &ServerPacket{}
+	if err := conn.ReadJSON(reply); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	now := float64(clock.Now().UnixMilli())
+	if reply.Response["serverReceiveTime"] != now || reply.Response["serverTransmitTime"] != now {
+		t.Fatalf("expected both stamps at %v, got %v", now, reply.Response)
+	}
+}
+
+func TestTimerSendsPhaseDeadlines(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	start := float64(clock.Now().UnixMilli())
+
+	wire := func() map[string]interface{} {
+		data, err := json.Marshal(room.Timer)
+		if err != nil {
+			t.Fatalf("marshal failed: %v", err)
+		}
+		var decoded map[string]interface{}
+		json.Unmarshal(data, &decoded)
+		return decoded
+	}
+	if got := wire(); got["phaseEndsAt"] != nil || got["phaseStartedAt"] != nil {
+		t.Fatalf("an idle timer has no deadline, got %v", got["phaseEndsAt"])
+	}
+
+	room.start_protocol(host)
+	clock.Advance(100 * time.Second)
+	got := wire()
+	if got["phaseStartedAt"] != start || got["phaseEndsAt"] != start+1500000 || got["serverTime"] != start+100000 {
+		t.Fatalf("unexpected deadlines %v %v %v", got["phaseStartedAt"], got["phaseEndsAt"], got["serverTime"])
+	}
+
+	// A pause has no deadline, and resuming pushes it back by the pause
+	room.Timer.Pause()
+	if got := wire(); got["phaseEndsAt"] != nil {
+		t.Fatalf("a paused timer has no deadline, got %v", got["phaseEndsAt"])
+	}
+	clock.Advance(60 * time.Second)
+	room.Timer.Resume(room)
+	if got := wire(); got["phaseEndsAt"] != start+1560000 {
+		t.Fatalf("expected the deadline to move by the pause, got %v", got["phaseEndsAt"])
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	MinUsernameLength = 2
+	MaxUsernameLength = 24
+)
+
+// Username collision policies for a room.
+const (
+	UsernameReject = "reject" // Refuse a join whose name is already taken
+	UsernameSuffix = "suffix" // Append " (2)", " (3)", ... until the name is free
+)
+
+// normalizeUsername applies NFKC normalization, strips control and format
+// characters, collapses whitespace and enforces the length limits.
+func normalizeUsername(raw string) (string, error) {
+	normalized := norm.NFKC.String(raw)
+
+	var b strings.Builder
+	for _, ch := range normalized {
+		if unicode.IsSpace(ch) {
+			b.WriteRune(' ')
+			continue
+		}
+		if unicode.IsControl(ch) || unicode.Is(unicode.Cf, ch) {
+			continue
+		}
+		b.WriteRune(ch)
+	}
+	username := strings.Join(strings.Fields(b.String()), " ")
+
+	length := utf8.RuneCountInString(username)
+	if length < MinUsernameLength {
+		return "", fmt.Errorf("Username must be at least %d characters", MinUsernameLength)
+	}
+	if length > MaxUsernameLength {
+		return "", fmt.Errorf("Username must be at most %d characters", MaxUsernameLength)
+	}
+	return username, nil
+}
+
+// uniqueUsername resolves name against the other hikers in the room using the
+// room's collision policy. The caller must hold HikersMux.
+func (r *Room) uniqueUsername(h *Client, name string) (string, error) {
+	if !r.usernameTaken(h, name) {
+		return name, nil
+	}
+	if r.UsernamePolicy == UsernameReject {
+		return "", fmt.Errorf("Username %s is already taken in this room", name)
+	}
+
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		base := []rune(name)
+		if room := MaxUsernameLength - utf8.RuneCountInString(suffix); len(base) > room {
+			base = base[:room]
+		}
+		candidate := string(base) + suffix
+		if !r.usernameTaken(h, candidate) {
+			return candidate, nil
+		}
+	}
+}
+
+func (r *Room) usernameTaken(h *Client, name string) bool {
+	for id, hiker := range r.Hikers {
+		if id != h.Id && strings.EqualFold(hiker.Username, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"  Trail\tBlazer  ", "Trail Blazer", false},
+		{"Hi\u0000ker\u200b", "Hiker", false},
+		{"Ｈｉｋｅｒ", "Hiker", false}, // Fullwidth letters fold to ASCII
+		{"Café", "Café", false},
+		{"a", "", true},
+		{strings.Repeat("x", MaxUsernameLength+1), "", true},
+	}
+	for _, c := range cases {
+		got, err := normalizeUsername(c.raw)
+		if (err != nil) != c.wantErr {
+			t.Errorf("normalizeUsername(%q) error = %v, wantErr %v", c.raw, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("normalizeUsername(%q) = %q, want %q", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestUsernameCollisionPolicy(t *testing.T) {
+	host := newTestHiker("1")
+	host.Username = "Hiker"
+	room := newTestRoom(host)
+	room.UsernamePolicy = UsernameSuffix
+
+	second := newTestHiker("2")
+	second.Username = "hiker"
+	if err := room.AddHiker(second); err != nil {
+		t.Fatalf("AddHiker failed: %v", err)
+	}
+	if second.Username != "hiker (2)" {
+		t.Fatalf("expected suffixed name, got %q", second.Username)
+	}
+
+	room.UsernamePolicy = UsernameReject
+	third := newTestHiker("3")
+	third.Username = "HIKER"
+	if err := room.AddHiker(third); err == nil {
+		t.Fatal("expected duplicate name to be rejected")
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errRoomFull is returned by AddHiker when the room is at capacity.
+var errRoomFull = errors.New("room is full")
+
+// joinWaitlist queues h behind the hikers already waiting and tells it its position.
+func (r *Room) joinWaitlist(h *Client) {
+	r.HikersMux.Lock()
+	for _, waiting := range r.Waitlist {
+		if waiting.Id == h.Id {
+			r.HikersMux.Unlock()
+			r.sendWaitlistPositions()
+			return
+		}
+	}
+	r.Waitlist = append(r.Waitlist, h)
+	h.setRoomId(r.Id) // Lets removeClient drop the hiker from the waitlist on disconnect
+	r.HikersMux.Unlock()
+
+	fmt.Printf("Hiker %s waitlisted for room %s\n", h.Username, r.Id)
+	r.sendWaitlistPositions()
+}
+
+// removeFromWaitlist drops h from the waitlist and reports whether it was waiting.
+func (r *Room) removeFromWaitlist(h *Client) bool {
+	r.HikersMux.Lock()
+	defer r.HikersMux.Unlock()
+	for i, waiting := range r.Waitlist {
+		if waiting.Id == h.Id {
+			r.Waitlist = append(r.Waitlist[:i], r.Waitlist[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isWaitlisted reports whether h is waiting for a spot in the room.
+func (r *Room) isWaitlisted(h *Client) bool {
+	r.HikersMux.RLock()
+	defer r.HikersMux.RUnlock()
+	for _, waiting := range r.Waitlist {
+		if waiting.Id == h.Id {
+			return true
+		}
+	}
+	return false
+}
+
+// waitlistAllowed lists the protocols a waitlisted hiker may send to its room.
+func waitlistAllowed(protocol string) bool {
+	return protocol == "join" || protocol == "leave"
+}
+
+// admitFromWaitlist moves waiting hikers into the room, in order, until it is
+// full again or the waitlist is empty.
+func (r *Room) admitFromWaitlist() {
+	admitted := false
+	for {
+		r.HikersMux.Lock()
+		capacity := r.capacity()
+		if len(r.Waitlist) == 0 || (capacity > 0 && len(r.Hikers) >= capacity) {
+			r.HikersMux.Unlock()
+			break
+		}
+		next := r.Waitlist[0]
+		r.Waitlist = r.Waitlist[1:]
+		r.HikersMux.Unlock()
+
+		fmt.Printf("Admitting %s from waitlist of room %s\n", next.Username, r.Id)
+		if err := r.join_protocol(next); err != nil {
+			fmt.Printf("Error admitting %s from waitlist: %v\n", next.Username, err)
+			continue
+		}
+		admitted = true
+	}
+	if admitted {
+		r.sendWaitlistPositions()
+	}
+}
+
+// sendWaitlistPositions tells every waiting hiker where it is in line.
+func (r *Room) sendWaitlistPositions() {
+	r.HikersMux.RLock()
+	waitlist := make([]*Client, len(r.Waitlist))
+	copy(waitlist, r.Waitlist)
+	r.HikersMux.RUnlock()
+
+	for i, waiting := range waitlist {
+		packet, err := r.packMessage("waitlist", map[string]interface{}{
+			"type":     "direct",
+			"status":   "waiting",
+			"message":  fmt.Sprintf("Room is full, you are number %d in line", i+1),
+			"position": i + 1,
+			"waiting":  len(waitlist),
+			"capacity": r.capacity(),
+		}, waiting)
+		if err != nil {
+			fmt.Printf("Error in sendWaitlistPositions: %v\n", err)
+			continue
+		}
+		select {
+		case waiting.MsgCh <- packet:
+		default:
+			fmt.Printf("Waitlist update dropped for %v\n", waiting.Username)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import "testing"
+
+func TestWaitlistAdmitsInOrder(t *testing.T) {
+	host := newTestHiker("1")
+	room := newTestRoom(host)
+	if err := room.applyRoomConfig(map[string]interface{}{"maxHikers": 2}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+
+	second := newTestHiker("2")
+	third := newTestHiker("3")
+	fourth := newTestHiker("4")
+	for _, h := range []*Client{second, third, fourth} {
+		if err := room.join_protocol(h); err != nil {
+			t.Fatalf("join failed for %s: %v", h.Id, err)
+		}
+	}
+
+	if len(room.Hikers) != 2 || len(room.Waitlist) != 2 {
+		t.Fatalf("expected 2 hikers and 2 waiting, got %d and %d", len(room.Hikers), len(room.Waitlist))
+	}
+	if packet := lastPacket(t, fourth); packet.Response["position"] != 2 {
+		t.Fatalf("expected fourth hiker at position 2, got %v", packet.Response["position"])
+	}
+
+	// Third leaves the line, fourth moves up
+	room.RemoveHiker(third)
+	if packet := lastPacket(t, fourth); packet.Response["position"] != 1 {
+		t.Fatalf("expected fourth hiker at position 1, got %v", packet.Response["position"])
+	}
+
+	// A hiker leaving the room lets the next in line in
+	room.RemoveHiker(second)
+	if _, ok := room.Hikers[fourth.Id]; !ok {
+		t.Fatal("expected fourth hiker to be admitted")
+	}
+	if packet := lastPacket(t, fourth); packet.Header.Protocol != "join" {
+		t.Fatalf("expected join reply on admission, got %s", packet.Header.Protocol)
+	}
+	if len(room.Waitlist) != 0 {
+		t.Fatalf("expected empty waitlist, got %d", len(room.Waitlist))
+	}
+}
+
+func TestRoomConfigRespectsServerLimit(t *testing.T) {
+	room := newTestRoom(newTestHiker("1"))
+	room.ServerMaxHikers = 10
+	if err := room.applyRoomConfig(map[string]interface{}{"maxHikers": 11}); err == nil {
+		t.Fatal("expected maxHikers above the server limit to fail")
+	}
+	if room.capacity() != 10 {
+		t.Fatalf("expected server limit as capacity, got %d", room.capacity())
+	}
+}
+
+func TestWaitlistedHikerCannotActInRoom(t *testing.T) {
+	host := newTestHiker("1")
+	room := newTestRoom(host)
+	if err := room.applyRoomConfig(map[string]interface{}{"maxHikers": 1}); err != nil {
+		t.Fatalf("applyRoomConfig failed: %v", err)
+	}
+	waiting := newTestHiker("2")
+	if err := room.join_protocol(waiting); err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		room.handleRoomMessages()
+		close(done)
+	}()
+	room.IncomingMsgs <- &ClientPacket{Header: Header{Protocol: "pause", RoomId: room.Id}, Hiker: waiting}
+	close(room.IncomingMsgs)
+	<-done
+
+	if packet := lastPacket(t, waiting); packet.Header.Protocol != "Error" {
+		t.Fatalf("expected an error for the waitlisted hiker, got %s", packet.Header.Protocol)
+	}
+	if waiting.IsPaused || room.Session.Strikes != 0 {
+		t.Fatal("a waitlisted hiker paused in the room")
+	}
+}
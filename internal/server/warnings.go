@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DefaultWarnings are the seconds left in a phase at which the built-in
+// presets warn the room.
+var DefaultWarnings = []uint16{300, 60, 10}
+
+const (
+	maxWarnings      = 10
+	maxCountdownTime = 600 // Seconds
+)
+
+// validateWarnings checks the Warnings and CountdownTime of a TimerConfig.
+func (c TimerConfig) validateWarnings() error {
+	if c.CountdownTime > maxCountdownTime {
+		return fmt.Errorf("countdownTime must be at most %d seconds", maxCountdownTime)
+	}
+	if len(c.Warnings) > maxWarnings {
+		return fmt.Errorf("at most %d warnings are allowed", maxWarnings)
+	}
+	for _, warning := range c.Warnings {
+		if warning == 0 {
+			return fmt.Errorf("warnings must be at least 1 second")
+		}
+	}
+	return nil
+}
+
+// armWarnings sets a timeWarning for each of Warnings that falls within the
+// d left in the current phase, replacing the previous phase's warnings. The
+// warnings are queued to the room goroutine when they fire. The caller must
+// hold TimerMux.
+func (t *Timer) armWarnings(r *Room, d time.Duration) {
+	t.stopWarnings()
+	phase, armed := t.currentPhase(), t.warningsArmed
+	for _, warning := range slices.Compact(slices.Sorted(slices.Values(t.Warnings))) {
+		left := toDuration(warning)
+		if left >= d {
+			continue
+		}
+		t.warningTimers = append(t.warningTimers, t.clock().AfterFunc(d-left, func() {
+			r.enqueue("timeWarning", map[string]interface{}{"phase": phase, "left": left, "armed": armed})
+		}))
+	}
+}
+
+// stopWarnings cancels the pending warnings, along with any already queued.
+// The caller must hold TimerMux.
+func (t *Timer) stopWarnings() {
+	for _, timer := range t.warningTimers {
+		timer.Stop()
+	}
+	t.warningTimers = nil
+	t.warningsArmed++
+}
+
+// timeWarning tells the room left remains in phase. It runs on the room
+// goroutine, queued by armWarnings, and says nothing if the phase changed,
+// paused or was rearmed since.
+func (r *Room) timeWarning(phase Phase, left time.Duration, armed uint64) {
+	t := r.Timer
+	t.TimerMux.RLock()
+	current := t.currentPhase() == phase && !t.IsPaused && t.warningsArmed == armed
+	t.TimerMux.RUnlock()
+	if !current {
+		return
+	}
+	r.broadcast("timeWarning", map[string]interface{}{
+		"type":          "broadcast",
+		"phase":         phase,
+		"remainingTime": left.Seconds(),
+		"timer":         r.Timer,
+		"message":       fmt.Sprintf("%s left in %s", left, phase),
+	})
+}
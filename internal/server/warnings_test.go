@@ -0,0 +1,103 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountdownBeforeFocus(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.Timer.CountdownTime = 10
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if room.Timer.Phase != PhaseCountdown || room.Timer.Duration != 10*time.Second {
+		t.Fatalf("expected a 10s countdown, got %s for %s", room.Timer.Phase, room.Timer.Duration)
+	}
+	if err := room.start_protocol(host); err == nil {
+		t.Fatal("expected a second start during the countdown to fail")
+	}
+	clock.Advance(10 * time.Second)
+	if room.Timer.Phase != PhaseFocus || room.Timer.Duration != 1500*time.Second {
+		t.Fatalf("expected focus after the countdown, got %s", room.Timer.Phase)
+	}
+}
+
+func TestWarningsBeforePhaseEnds(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.Timer.Pace = 0
+	room.Timer.Warnings = []uint16{60, 600, 10}
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	clock.Advance(1500*time.Second - 600*time.Second)
+	runQueued(room)
+	packet := waitForProtocol(t, host, "timeWarning")
+	if packet.Response["remainingTime"] != 600.0 || packet.Response["phase"] != PhaseFocus {
+		t.Fatalf("expected a 10 minute focus warning, got %+v", packet.Response)
+	}
+
+	// Pausing holds the next warning until the time left reaches it again
+	if err := room.pauseRoom_protocol(host); err != nil {
+		t.Fatalf("pauseRoom failed: %v", err)
+	}
+	clock.Advance(time.Hour)
+	runQueued(room)
+	if err := room.resumeRoom_protocol(host); err != nil {
+		t.Fatalf("resumeRoom failed: %v", err)
+	}
+	for len(host.MsgCh) > 0 {
+		if packet := <-host.MsgCh; packet.Header.Protocol == "timeWarning" {
+			t.Fatalf("unexpected warning while paused: %+v", packet.Response)
+		}
+	}
+	clock.Advance(540 * time.Second)
+	runQueued(room)
+	packet = waitForProtocol(t, host, "timeWarning")
+	if packet.Response["remainingTime"] != 60.0 {
+		t.Fatalf("expected a 1 minute warning, got %+v", packet.Response)
+	}
+
+	// The short break is shorter than the 10 minute warning
+	clock.Advance(60 * time.Second)
+	runQueued(room)
+	if room.Timer.Phase != PhaseShortBreak {
+		t.Fatalf("expected a short break, got %s", room.Timer.Phase)
+	}
+	clock.Advance(300*time.Second - 60*time.Second)
+	runQueued(room)
+	packet = waitForProtocol(t, host, "timeWarning")
+	if packet.Response["remainingTime"] == 10.0 {
+		// Focus warned at 10 seconds too
+		packet = waitForProtocol(t, host, "timeWarning")
+	}
+	if packet.Response["remainingTime"] != 60.0 || packet.Response["phase"] != PhaseShortBreak {
+		t.Fatalf("expected a 1 minute break warning, got %+v", packet.Response)
+	}
+}
+
+func TestQueuedWarningDroppedAfterEnd(t *testing.T) {
+	host := newTestHiker("1")
+	room, clock := newClockedRoom(t, host)
+	room.Timer.Pace = 0
+	room.Timer.Warnings = []uint16{60}
+
+	if err := room.start_protocol(host); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	// The warning fires, but the room ends the session before running it
+	clock.Advance(1440 * time.Second)
+	if err := room.end_protocol(host); err != nil {
+		t.Fatalf("end failed: %v", err)
+	}
+	runQueued(room)
+	for len(host.MsgCh) > 0 {
+		if packet := <-host.MsgCh; packet.Header.Protocol == "timeWarning" {
+			t.Fatalf("unexpected warning after end: %+v", packet.Response)
+		}
+	}
+}